@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfigFile reads a YAML (or JSON) file whose keys are flag names, e.g.
+//
+//	host: [example.com, www.example.com]
+//	organization: Example Co
+//	duration: 720h
+//
+// and sets each flag in fs that wasn't set explicitly on the command line from
+// it. Lists are joined with commas, like the --host flag expects.
+func loadConfigFile(fs *flag.FlagSet, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// decode to nodes rather than Go values, so that e.g. an unquoted 0644
+	// or timestamp reaches the flag as written, not as an int or time.Time
+	var values map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("could not parse %s: %v", path, err)
+	}
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	for name, node := range values {
+		if name == "config" || fs.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown option %q", path, name)
+		}
+		if explicit[name] {
+			continue
+		}
+		var value string
+		switch node.Kind {
+		case yaml.ScalarNode:
+			value = node.Value
+		case yaml.SequenceNode:
+			parts := make([]string, len(node.Content))
+			for i, item := range node.Content {
+				if item.Kind != yaml.ScalarNode {
+					return fmt.Errorf("%s: %s must be a list of values", path, name)
+				}
+				parts[i] = item.Value
+			}
+			value = strings.Join(parts, ",")
+		default:
+			return fmt.Errorf("%s: %s must be a value or a list of values", path, name)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: invalid value %q for %s: %v", path, value, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFlags returns a FlagSet with a few of the flags main defines.
+func testFlags() (*flag.FlagSet, *string, *string, *time.Duration, *bool) {
+	fs := flag.NewFlagSet("generate-cert", flag.ContinueOnError)
+	host := fs.String("host", "", "")
+	org := fs.String("organization", "Acme Co", "")
+	validFor := fs.Duration("duration", 365*24*time.Hour, "")
+	force := fs.Bool("force", false, "")
+	fs.String("config", "", "")
+	fs.String("cert-perm", "0644", "")
+	fs.String("not-before", "", "")
+	return fs, host, org, validFor, force
+}
+
+// writeConfig writes data to a file in a temporary directory and returns its
+// path.
+func writeConfig(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	for name, data := range map[string]string{
+		"config.yaml": "host: [a.example.test, b.example.test]\norganization: Example Co\nduration: 720h\nforce: true\n",
+		"config.json": `{"host": ["a.example.test", "b.example.test"], "organization": "Example Co", "duration": "720h", "force": true}`,
+	} {
+		fs, host, org, validFor, force := testFlags()
+		if err := fs.Parse(nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := loadConfigFile(fs, writeConfig(t, name, data)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if *host != "a.example.test,b.example.test" {
+			t.Errorf("%s: host: got %q", name, *host)
+		}
+		if *org != "Example Co" {
+			t.Errorf("%s: organization: got %q", name, *org)
+		}
+		if *validFor != 720*time.Hour {
+			t.Errorf("%s: duration: got %v", name, *validFor)
+		}
+		if !*force {
+			t.Errorf("%s: expected force to be set", name)
+		}
+	}
+}
+
+func TestLoadConfigFileUnquotedValues(t *testing.T) {
+	fs, host, _, _, _ := testFlags()
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	path := writeConfig(t, "config.yaml", "cert-perm: 0640\nnot-before: 2026-01-01T00:00:00Z\nhost: [a.example.test, 10.0.0.1]\n")
+	if err := loadConfigFile(fs, path); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Lookup("cert-perm").Value.String(); got != "0640" {
+		t.Errorf("cert-perm: got %q, want the octal mode as written", got)
+	}
+	if _, err := parsePerm("cert-perm", fs.Lookup("cert-perm").Value.String()); err != nil {
+		t.Error(err)
+	}
+	if got := fs.Lookup("not-before").Value.String(); got != "2026-01-01T00:00:00Z" {
+		t.Errorf("not-before: got %q, want the timestamp as written", got)
+	}
+	if *host != "a.example.test,10.0.0.1" {
+		t.Errorf("host: got %q", *host)
+	}
+}
+
+func TestLoadConfigFileFlagsTakePrecedence(t *testing.T) {
+	fs, host, org, validFor, _ := testFlags()
+	if err := fs.Parse([]string{"--host", "cli.example.test", "--duration", "24h"}); err != nil {
+		t.Fatal(err)
+	}
+	path := writeConfig(t, "config.yaml", "host: file.example.test\norganization: Example Co\nduration: 720h\n")
+	if err := loadConfigFile(fs, path); err != nil {
+		t.Fatal(err)
+	}
+	if *host != "cli.example.test" || *validFor != 24*time.Hour {
+		t.Errorf("expected command line flags to win, got host %q and duration %v", *host, *validFor)
+	}
+	if *org != "Example Co" {
+		t.Errorf("expected organization from the file, got %q", *org)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		want string
+	}{
+		{"hots: a.example.test\n", `unknown option "hots"`},
+		{"config: other.yaml\n", `unknown option "config"`},
+		{"duration: a while\n", "invalid value"},
+		{"force: maybe\n", "invalid value"},
+		{"host: [unclosed\n", "could not parse"},
+		{"host: {a: b}\n", "must be a value"},
+	} {
+		fs, _, _, _, _ := testFlags()
+		if err := fs.Parse(nil); err != nil {
+			t.Fatal(err)
+		}
+		err := loadConfigFile(fs, writeConfig(t, "config.yaml", tc.data))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: expected an error containing %q, got %v", tc.data, tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	gencert "github.com/meterup/generate-cert/lib"
+)
+
+// writeDryRun describes the certs that cfg would produce, without generating
+// any keys.
+func writeDryRun(w io.Writer, cfg gencert.Config) {
+	cfg = cfg.Resolved()
+	notBefore := cfg.NotBefore.UTC().Truncate(time.Second)
+	validity := func(notAfter time.Time) string {
+		return fmt.Sprintf("%s to %s", notBefore.Format(time.RFC3339), notAfter.UTC().Format(time.RFC3339))
+	}
+
+	var key string
+	switch cfg.KeyType {
+	case gencert.KeyECDSA:
+		key = "ecdsa, curve " + cfg.Curve.Params().Name
+	case gencert.KeyRSA:
+		key = fmt.Sprintf("rsa, %d bits", cfg.RSABits)
+	default:
+		key = cfg.KeyType.String()
+	}
+	fmt.Fprintf(w, "Dry run - no keys were generated and no files were written.\n\nKey type: %s\n", key)
+
+	if cfg.RootCAPrivateKey != "" {
+		fmt.Fprintf(w, "Root CA:  loaded from %s and %s\n", cfg.RootCACert, cfg.RootCAPrivateKey)
+	} else {
+		fmt.Fprintf(w, "Root CA:  generated, valid %s\n", validity(notBefore.Add(cfg.RootValidFor)))
+	}
+	if cfg.Intermediate || cfg.IntermediateOnly {
+		fmt.Fprintf(w, "Intermediate CA: generated, valid %s\n", validity(notBefore.Add(cfg.IntermediateValidFor)))
+	}
+	if cfg.IntermediateOnly {
+		return
+	}
+
+	leafNotAfter := cfg.LeafNotAfter
+	if leafNotAfter.IsZero() {
+		leafNotAfter = notBefore.Add(cfg.LeafValidFor)
+	}
+	certs := []string{"Leaf"}
+	if !cfg.SkipClient {
+		certs = append(certs, "Client")
+	}
+	for _, name := range certs {
+		fmt.Fprintf(w, "\n%s certificate:\n", name)
+		if cfg.EmptySubject {
+			fmt.Fprintf(w, "  Subject:      (empty)\n")
+		} else {
+			fmt.Fprintf(w, "  Common Name:  %s\n", cfg.CommonName)
+			fmt.Fprintf(w, "  Organization: %s\n", strings.Join(cfg.Orgs, ", "))
+		}
+		fmt.Fprintf(w, "  Hosts:        %s\n", strings.Join(cfg.Hosts, ", "))
+		if len(cfg.EmailAddresses) > 0 {
+			fmt.Fprintf(w, "  Emails:       %s\n", strings.Join(cfg.EmailAddresses, ", "))
+		}
+		if len(cfg.URIs) > 0 {
+			fmt.Fprintf(w, "  URIs:         %s\n", strings.Join(cfg.URIs, ", "))
+		}
+		if name == "Client" && cfg.ClientValidFor != 0 {
+			fmt.Fprintf(w, "  Valid:        %s\n", validity(notBefore.Add(cfg.ClientValidFor)))
+		} else {
+			fmt.Fprintf(w, "  Valid:        %s\n", validity(leafNotAfter))
+		}
+	}
+}
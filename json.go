@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	gencert "github.com/meterup/generate-cert/lib"
+)
+
+// jsonCert is the --json representation of a generated cert.
+type jsonCert struct {
+	Certificate       string    `json:"certificate"`
+	PrivateKey        string    `json:"private_key,omitempty"`
+	Serial            string    `json:"serial"`
+	NotBefore         time.Time `json:"not_before"`
+	NotAfter          time.Time `json:"not_after"`
+	DNSNames          []string  `json:"dns_names,omitempty"`
+	IPAddresses       []string  `json:"ip_addresses,omitempty"`
+	EmailAddresses    []string  `json:"email_addresses,omitempty"`
+	URIs              []string  `json:"uris,omitempty"`
+	FingerprintSHA256 string    `json:"fingerprint_sha256"`
+}
+
+type jsonCerts struct {
+	Root         *jsonCert `json:"root"`
+	Intermediate *jsonCert `json:"intermediate,omitempty"`
+	Leaf         *jsonCert `json:"leaf"`
+	Client       *jsonCert `json:"client,omitempty"`
+}
+
+func newJSONCert(c *gencert.Cert, includeKey bool) *jsonCert {
+	if c == nil {
+		return nil
+	}
+	cert := c.Certificate
+	jc := &jsonCert{
+		Certificate:       string(c.PublicBytes),
+		Serial:            cert.SerialNumber.String(),
+		NotBefore:         cert.NotBefore,
+		NotAfter:          cert.NotAfter,
+		DNSNames:          cert.DNSNames,
+		EmailAddresses:    cert.EmailAddresses,
+		FingerprintSHA256: c.FingerprintSHA256Hex(),
+	}
+	if includeKey {
+		jc.PrivateKey = string(c.PrivateBytes)
+	}
+	for _, ip := range cert.IPAddresses {
+		jc.IPAddresses = append(jc.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		jc.URIs = append(jc.URIs, uri.String())
+	}
+	return jc
+}
+
+// writeJSON writes certs to w as a JSON object. The root private key is only
+// included if includeRootKey is true, i.e. if the root was just generated.
+func writeJSON(w io.Writer, certs *gencert.Certs, includeRootKey bool) error {
+	out := jsonCerts{
+		Root:         newJSONCert(certs.Root, includeRootKey),
+		Intermediate: newJSONCert(certs.Intermediate, true),
+		Leaf:         newJSONCert(certs.Leaf, true),
+		Client:       newJSONCert(certs.Client, true),
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// manifestFile is the --manifest representation of a written file.
+type manifestFile struct {
+	Path     string     `json:"path"`
+	Role     string     `json:"role"`
+	SHA256   string     `json:"sha256"`
+	NotAfter *time.Time `json:"not_after,omitempty"`
+}
+
+type manifest struct {
+	Files []manifestFile `json:"files"`
+}
+
+// marshalManifest returns a JSON manifest describing files.
+func marshalManifest(files []pendingFile) ([]byte, error) {
+	m := manifest{Files: make([]manifestFile, len(files))}
+	for i, f := range files {
+		sum := sha256.Sum256(f.data)
+		m.Files[i] = manifestFile{
+			Path:   f.path,
+			Role:   f.role,
+			SHA256: hex.EncodeToString(sum[:]),
+		}
+		if f.cert != nil {
+			notAfter := f.cert.NotAfter
+			m.Files[i].NotAfter = &notAfter
+		}
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
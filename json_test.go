@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	gencert "github.com/meterup/generate-cert/lib"
+)
+
+func TestWriteJSON(t *testing.T) {
+	certs, err := gencert.Generate(gencert.Config{Hosts: []string{"json.example.test", "10.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, certs, true); err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"root", "leaf", "client"} {
+		c, ok := raw[name]
+		if !ok {
+			t.Fatalf("expected a %q object, got %s", name, buf.Bytes())
+		}
+		for _, field := range []string{"certificate", "private_key", "serial", "not_before", "not_after", "fingerprint_sha256"} {
+			if _, ok := c[field]; !ok {
+				t.Errorf("%s: missing %q", name, field)
+			}
+		}
+	}
+	if _, ok := raw["intermediate"]; ok {
+		t.Error("expected no intermediate without Config.Intermediate")
+	}
+
+	var out jsonCerts
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	leaf := out.Leaf
+	if leaf.Certificate != string(certs.Leaf.PublicBytes) || leaf.PrivateKey != string(certs.Leaf.PrivateBytes) {
+		t.Error("expected the leaf's PEM encoded certificate and key")
+	}
+	if leaf.Serial != certs.Leaf.Certificate.SerialNumber.String() {
+		t.Errorf("serial: got %s, want %s", leaf.Serial, certs.Leaf.Certificate.SerialNumber)
+	}
+	if len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != "json.example.test" {
+		t.Errorf("dns_names: got %v", leaf.DNSNames)
+	}
+	if len(leaf.IPAddresses) != 1 || leaf.IPAddresses[0] != "10.0.0.1" {
+		t.Errorf("ip_addresses: got %v", leaf.IPAddresses)
+	}
+	if leaf.FingerprintSHA256 != certs.Leaf.FingerprintSHA256Hex() {
+		t.Errorf("fingerprint_sha256: got %s, want %s", leaf.FingerprintSHA256, certs.Leaf.FingerprintSHA256Hex())
+	}
+}
+
+func TestWriteJSONLoadedRoot(t *testing.T) {
+	certs, err := gencert.Generate(gencert.Config{Hosts: []string{"json.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, certs, false); err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["root"]["private_key"]; ok {
+		t.Error("expected the root private key to be omitted for a loaded root")
+	}
+	if _, ok := raw["root"]["certificate"]; !ok {
+		t.Error("expected the root certificate to be included")
+	}
+	if _, ok := raw["leaf"]["private_key"]; !ok {
+		t.Error("expected the leaf private key to be included")
+	}
+}
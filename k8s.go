@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+
+	gencert "github.com/meterup/generate-cert/lib"
+	"gopkg.in/yaml.v3"
+)
+
+// k8sSecret is a Kubernetes Secret of type kubernetes.io/tls.
+type k8sSecret struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sMetadata       `yaml:"metadata"`
+	Type       string            `yaml:"type"`
+	Data       map[string]string `yaml:"data"`
+}
+
+type k8sMetadata struct {
+	Name string `yaml:"name"`
+}
+
+// writeK8sSecret writes a Kubernetes TLS Secret named name to w, with the leaf
+// cert and its issuer as tls.crt, the leaf key as tls.key and the root CA as
+// ca.crt, ready for kubectl apply.
+func writeK8sSecret(w io.Writer, name string, certs *gencert.Certs) error {
+	if certs.Leaf.Private.Type == "ENCRYPTED PRIVATE KEY" {
+		return errors.New("Kubernetes TLS secrets cannot hold an encrypted private key, remove --key-password")
+	}
+	secret := k8sSecret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   k8sMetadata{Name: name},
+		Type:       "kubernetes.io/tls",
+		Data: map[string]string{
+			"tls.crt": base64.StdEncoding.EncodeToString(certs.FullChainPEM()),
+			"tls.key": base64.StdEncoding.EncodeToString(certs.Leaf.PrivateBytes),
+			"ca.crt":  base64.StdEncoding.EncodeToString(certs.Root.PublicBytes),
+		},
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(secret); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -2,245 +2,1607 @@ package gencert
 
 import (
 	"bytes"
+	"context"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"math/big"
 	"net"
+	"net/url"
+	"strings"
 	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/sync/errgroup"
 )
 
 const Version = "0.4"
 
+var (
+	// ErrMissingRootPair is returned when only one of the root CA certificate
+	// and private key is set.
+	ErrMissingRootPair = errors.New("gencert: must set both RootCACert and RootCAPrivateKey, or neither")
+	// ErrRootValidFor is returned when RootValidFor is set along with a root
+	// CA to load.
+	ErrRootValidFor = errors.New("gencert: cannot set RootValidFor when loading root cert from disk")
+	// ErrNoIdentity is returned when there are no hosts, email addresses,
+	// URIs or common name to issue the leaf and client certs for, since a
+	// cert without any of them can't be matched against anything.
+	ErrNoIdentity = errors.New("gencert: must set at least one host, email address, URI or common name")
+	// ErrLeafValidForTooLong is returned by CheckLeafValidity when leaf certs
+	// would be valid for longer than MaxLeafValidFor.
+	ErrLeafValidForTooLong = errors.New("gencert: leaf certs valid for longer than 398 days are rejected by browsers")
+	// ErrNoLeaf is returned by methods on Certs that need the leaf cert when
+	// there isn't one, because IntermediateOnly was set.
+	ErrNoLeaf = errors.New("gencert: no leaf cert, IntermediateOnly was set")
+)
+
+// MaxLeafValidFor is the longest validity period that browsers accept for
+// TLS server certs, per the CA/Browser Forum baseline requirements.
+const MaxLeafValidFor = 398 * 24 * time.Hour
+
 type Cert struct {
 	Private *pem.Block
 	Public  *pem.Block
 
 	PrivateBytes []byte
 	PublicBytes  []byte
+
+	// The raw DER encoding of the private key and certificate, i.e. the
+	// contents of Private and Public.
+	PrivateDER []byte
+	PublicDER  []byte
+
+	// The validity period of the certificate.
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	// The parsed certificate, for access to its SANs, serial number and
+	// other fields without parsing PublicDER again.
+	Certificate *x509.Certificate
+}
+
+// FingerprintSHA256 returns the SHA-256 hash of the DER encoded certificate.
+func (c *Cert) FingerprintSHA256() [32]byte {
+	return sha256.Sum256(c.Public.Bytes)
+}
+
+// FingerprintSHA256Hex returns the SHA-256 fingerprint of the certificate as
+// colon-separated hex, e.g. "ab:cd:...".
+func (c *Cert) FingerprintSHA256Hex() string {
+	sum := c.FingerprintSHA256()
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// PublicKeyPEM returns the certificate's public key, i.e. its Subject Public
+// Key Info, as a PEM encoded "PUBLIC KEY" block.
+func (c *Cert) PublicKeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(c.Certificate.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// SPKIPinSHA256 returns the base64 encoded SHA-256 hash of the certificate's
+// Subject Public Key Info, as used for public key pinning (e.g. the
+// "pin-sha256" directive in RFC 7469).
+func (c *Cert) SPKIPinSHA256() string {
+	sum := sha256.Sum256(c.Certificate.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// PublicBase64 returns the DER encoded certificate as a single line of
+// standard base64, without PEM headers, for config fields that hold a single
+// value.
+func (c *Cert) PublicBase64() string {
+	return base64.StdEncoding.EncodeToString(c.PublicDER)
+}
+
+// PrivateBase64 returns the DER encoded private key as a single line of
+// standard base64, without PEM headers.
+func (c *Cert) PrivateBase64() string {
+	return base64.StdEncoding.EncodeToString(c.PrivateDER)
+}
+
+// PublicBytesCRLF returns PublicBytes with "\r\n" line endings, for Windows
+// tools that don't accept PEM files with bare "\n" line endings.
+func (c *Cert) PublicBytesCRLF() []byte {
+	return crlf(c.PublicBytes)
+}
+
+// PrivateBytesCRLF returns PrivateBytes with "\r\n" line endings.
+func (c *Cert) PrivateBytesCRLF() []byte {
+	return crlf(c.PrivateBytes)
+}
+
+// crlf replaces each "\n" line ending in b with "\r\n".
+func crlf(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte("\n"), []byte("\r\n"))
+}
+
+// WritePublicPEM writes the PEM encoded certificate to w.
+func (c *Cert) WritePublicPEM(w io.Writer) error {
+	return pem.Encode(w, c.Public)
+}
+
+// WritePrivatePEM writes the PEM encoded private key to w. It returns an error
+// if c has no private key, e.g. because it was issued by SignCSR.
+func (c *Cert) WritePrivatePEM(w io.Writer) error {
+	if c.Private == nil {
+		return errors.New("gencert: cert has no private key")
+	}
+	return pem.Encode(w, c.Private)
 }
 
 type Certs struct {
+	// Client is nil if Config.SkipClient was set. Leaf and Client are both
+	// nil if Config.IntermediateOnly was set.
 	Root, Leaf, Client *Cert
+	// Intermediate is the CA that signed Leaf and Client, or nil if they were
+	// signed directly by Root.
+	Intermediate *Cert
+}
+
+// KeyType is the algorithm used to generate private keys.
+type KeyType int
+
+const (
+	// KeyECDSA generates ECDSA keys on Curve. This is the default.
+	KeyECDSA KeyType = iota
+	// KeyRSA generates RSA keys, RSABits long.
+	KeyRSA
+	// KeyEd25519 generates Ed25519 keys.
+	KeyEd25519
+)
+
+func (k KeyType) String() string {
+	switch k {
+	case KeyECDSA:
+		return "ecdsa"
+	case KeyRSA:
+		return "rsa"
+	case KeyEd25519:
+		return "ed25519"
+	}
+	return fmt.Sprintf("KeyType(%d)", int(k))
+}
+
+// FullChainPEM returns the PEM encoded leaf certificate followed by the
+// certificate that signed it - the intermediate if there is one, otherwise the
+// root - suitable for use as e.g. nginx's ssl_certificate. It returns nil if
+// there is no leaf cert, i.e. IntermediateOnly was set.
+func (c *Certs) FullChainPEM() []byte {
+	return c.fullChainPEM(c.Leaf)
+}
+
+// ClientFullChainPEM is like FullChainPEM, but for the client cert, for
+// clients that present their issuing CA along with their cert. It returns nil
+// if there is no client cert.
+func (c *Certs) ClientFullChainPEM() []byte {
+	return c.fullChainPEM(c.Client)
+}
+
+// fullChainPEM returns the PEM encoded cert followed by the certificate that
+// signed it, or nil if cert is nil.
+func (c *Certs) fullChainPEM(cert *Cert) []byte {
+	if cert == nil {
+		return nil
+	}
+	issuer := c.Root
+	if c.Intermediate != nil {
+		issuer = c.Intermediate
+	}
+	chain := make([]byte, 0, len(cert.PublicBytes)+len(issuer.PublicBytes))
+	chain = append(chain, cert.PublicBytes...)
+	return append(chain, issuer.PublicBytes...)
+}
+
+// HAProxyPEM returns the leaf private key, followed by the leaf certificate,
+// the intermediate (if there is one) and the root, all PEM encoded, in the
+// single-file format HAProxy expects for its crt option. It returns nil if
+// there is no leaf cert, i.e. IntermediateOnly was set.
+func (c *Certs) HAProxyPEM() []byte {
+	if c.Leaf == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	buf.Write(c.Leaf.PrivateBytes)
+	buf.Write(c.Leaf.PublicBytes)
+	if c.Intermediate != nil {
+		buf.Write(c.Intermediate.PublicBytes)
+	}
+	buf.Write(c.Root.PublicBytes)
+	return buf.Bytes()
+}
+
+// Verify checks that the leaf cert chains to the root and is valid for server
+// authentication, and that the client cert (if there is one) chains to the
+// root and is valid for client authentication.
+func (c *Certs) Verify() error {
+	roots, err := c.rootPool()
+	if err != nil {
+		return err
+	}
+	intermediates := x509.NewCertPool()
+	if c.Intermediate != nil {
+		if !intermediates.AppendCertsFromPEM(c.Intermediate.PublicBytes) {
+			return errors.New("gencert: could not parse intermediate certificate")
+		}
+	}
+	for _, check := range []struct {
+		name  string
+		cert  *Cert
+		usage x509.ExtKeyUsage
+	}{
+		{"leaf", c.Leaf, x509.ExtKeyUsageServerAuth},
+		{"client", c.Client, x509.ExtKeyUsageClientAuth},
+	} {
+		if check.cert == nil {
+			continue
+		}
+		if _, err := check.cert.Certificate.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{check.usage},
+		}); err != nil {
+			return fmt.Errorf("gencert: %s certificate does not verify: %v", check.name, err)
+		}
+	}
+	return nil
 }
 
 type Config struct {
-	// Which hosts to sign certificates for.
+	// Which hosts to sign certificates for. Entries containing an "@" are
+	// treated as email addresses. Internationalized domain names are
+	// converted to punycode. Surrounding whitespace is trimmed, and
+	// Generate returns an error if any DNS names are invalid; a leading "*."
+	// wildcard is allowed. IPv6 addresses may be wrapped in brackets, as in
+	// "[::1]". CIDR ranges like "10.0.0.0/24" are rejected, since IP SANs
+	// can only hold single addresses.
 	Hosts []string
+	// Also add each IP address in Hosts to the DNS names, in its string form.
+	// This is non-standard - RFC 6125 says clients must not match an IP
+	// against a DNS name - but some old embedded TLS stacks only check the
+	// DNS names.
+	IPAsDNS bool
+	// Email addresses to add to the leaf and client certs.
+	EmailAddresses []string
+	// URIs to add to the leaf and client certs, e.g. SPIFFE IDs like
+	// "spiffe://trust-domain/workload".
+	URIs []string
 	// Which organization is issuing these certs, defaults to "Acme Co."
 	Org string
+	// Additional organizations to put in the subject, for certs that carry
+	// more than one O value. Org is appended to these if it's set. The
+	// values are encoded as a single multi-valued RDN, so their order in the
+	// cert may differ.
+	Orgs []string
+	// The organization to put on the root and intermediate CA certs, if it
+	// differs from Org.
+	RootOrg string
+	// The Common Name to put on a generated root CA cert, e.g. "Example
+	// Internal Root CA 2024", so it's identifiable in a trust store. By
+	// default the root has no Common Name.
+	RootCommonName string
+	// Leave the Extended Key Usage extension off a generated root CA cert,
+	// instead of limiting it to server and client auth. An EKU on a CA
+	// constrains what the certs below it can be used for, and some strict
+	// verifiers reject roots that have one.
+	RootNoEKU bool
+	// Leave the subject of the leaf and client certs empty, so they are
+	// identified only by their SANs. The root keeps its subject.
+	EmptySubject bool
+	// Don't copy each cert's serial number into the SerialNumber attribute
+	// of its subject, so the serial only appears once in the cert.
+	NoSubjectSerial bool
+	// Subject fields to put on every generated cert.
+	Country            []string
+	Province           []string
+	Locality           []string
+	OrganizationalUnit []string
+	// The Common Name to put on the leaf and client certs, defaults to the
+	// first DNS name or IP address in Hosts, as it appears in the SANs, e.g.
+	// in punycode.
+	CommonName string
 	// How long leaf and client certs should be valid for, defaults to one year.
 	LeafValidFor time.Duration
+	// When leaf and client certs should expire, instead of LeafValidFor after
+	// NotBefore, e.g. to line up the expiry of a batch of certs. It is an
+	// error to set both LeafValidFor and LeafNotAfter.
+	LeafNotAfter time.Time
+	// Make Validate and Generate return an error if leaf certs would be
+	// valid for longer than MaxLeafValidFor, as checked by
+	// CheckLeafValidity.
+	StrictValidity bool
+	// How long client certs should be valid for, if it differs from the leaf
+	// cert, e.g. for short-lived client certs. Defaults to the leaf cert's
+	// validity, from LeafValidFor or LeafNotAfter.
+	ClientValidFor time.Duration
 	// How long the root CA cert should be valid for, defaults to one year.
+	// Cannot be set when loading the root CA from disk.
 	RootValidFor time.Duration
+	// How long the intermediate CA cert should be valid for, defaults to
+	// RootValidFor. Unlike RootValidFor, this may be set when loading the
+	// root CA from disk.
+	IntermediateValidFor time.Duration
+	// When generated certs become valid, defaults to now. Validity durations
+	// are measured from NotBefore.
+	NotBefore time.Time
+	// How far before now generated certs become valid when NotBefore isn't
+	// set, so machines with a clock that's slightly behind don't reject them
+	// as not yet valid. An explicit NotBefore is used as is.
+	Backdate time.Duration
 	// Use root CA on disk to generate leaf certs, instead of generating a new
-	// one. Should be a .key file with a root CA private key.
+	// one. Should be a .key file with a PKCS#8, PKCS#1 or SEC1 encoded root CA
+	// private key; ECDSA, RSA and Ed25519 keys are supported.
 	RootCAPrivateKey string
 	// Should be a .pem file with a root CA certificate. It is an error to set
 	// RootCACert and not RootCAPrivateKey, or vice versa.
 	RootCACert string
+	// Which algorithm to use for generated keys, defaults to KeyECDSA.
+	KeyType KeyType
+	// Which curve to use for ECDSA keys, defaults to elliptic.P256(). Ignored
+	// unless KeyType is KeyECDSA.
+	Curve elliptic.Curve
+	// How many bits to use for RSA keys, defaults to 2048. Ignored unless
+	// KeyType is KeyRSA.
+	RSABits int
+	// The smallest RSA keys, in bits, to generate or sign with, defaults to
+	// 2048, so weak keys aren't used by accident. This also applies to
+	// loaded root CA and issuer keys and to keys passed to RenewLeaf. ECDSA
+	// curves weaker than P-256 are always rejected.
+	MinRSABits int
+	// Serial numbers to use for the leaf, client and root certs. If nil, a
+	// random 128-bit serial number is generated. The serial number is also
+	// copied into the SerialNumber attribute of the cert's subject, so two
+	// certs from the same organization can be told apart by their subject,
+	// unless NoSubjectSerial is set.
+	LeafSerial   *big.Int
+	ClientSerial *big.Int
+	RootSerial   *big.Int
+	// Called for the serial number of each cert that doesn't have one set
+	// above, instead of generating a random one, e.g. to take serials from
+	// a counter in a database. It must return a positive number, and never
+	// the same one twice for the same CA. It may be called concurrently
+	// when issuing certs with an Issuer from multiple goroutines.
+	SerialFunc func() (*big.Int, error)
+	// Key usage for the leaf cert. Defaults to KeyUsageDigitalSignature and
+	// ExtKeyUsageServerAuth when zero.
+	LeafKeyUsage    x509.KeyUsage
+	LeafExtKeyUsage []x509.ExtKeyUsage
+	// Allow the leaf cert to be used for client auth as well as server auth,
+	// for services in a mesh that use one cert for both sides of mutual TLS.
+	// Set SkipClient too if the separate client cert isn't needed.
+	// LeafExtKeyUsage takes precedence.
+	DualUsage bool
+	// Key usage for the client cert. Defaults to KeyUsageDigitalSignature and
+	// ExtKeyUsageClientAuth when zero.
+	ClientKeyUsage    x509.KeyUsage
+	ClientExtKeyUsage []x509.ExtKeyUsage
+	// Revocation and issuer information to advertise on the leaf and client
+	// certs: OCSP responder URLs, CRL distribution points, and the URL of the
+	// issuing CA certificate (the Authority Information Access extension).
+	OCSPServer            []string
+	CRLDistributionPoints []string
+	IssuingCertificateURL []string
+	// Source of randomness for serial numbers, keys and signatures, defaults
+	// to crypto/rand.Reader. Note that since Go 1.26 the standard library
+	// ignores custom readers when generating ECDSA and RSA keys and when
+	// signing with ECDSA or RSA keys; use testing/cryptotest.SetGlobalRandom
+	// for reproducible output in tests.
+	Rand io.Reader
+	// If set, generated private keys are encrypted with this password, using
+	// PKCS#8 with PBES2 (PBKDF2-HMAC-SHA256 and AES-256-CBC), and written as
+	// "ENCRYPTED PRIVATE KEY" PEM blocks.
+	KeyPassword string
+	// Write ECDSA keys as SEC1 "EC PRIVATE KEY" blocks and RSA keys as PKCS#1
+	// "RSA PRIVATE KEY" blocks, instead of PKCS#8 "PRIVATE KEY" blocks, for
+	// older tools that expect them. Ed25519 keys are always PKCS#8. Cannot be
+	// used with KeyPassword.
+	LegacyKeyFormat bool
+	// The signature algorithm to sign every cert with, e.g.
+	// x509.ECDSAWithSHA384, instead of letting crypto/x509 pick one based on
+	// the signing key. It must be compatible with the signing key; when
+	// loading a root CA from disk, that's the root's key for the certs it
+	// signs.
+	SignatureAlgorithm x509.SignatureAlgorithm
+	// If set, Generate logs each step (root generated, leaf signed, etc.) at
+	// the debug level.
+	Logger *slog.Logger
+	// Path length constraint for a generated root CA, mapped directly to
+	// x509.Certificate.MaxPathLen and MaxPathLenZero. By default there is no
+	// constraint; set MaxPathLenZero to allow a MaxPathLen of 0.
+	MaxPathLen     int
+	MaxPathLenZero bool
+	// Name constraints for a generated root CA. Certs chaining to the root
+	// will only verify for DNS names under PermittedDNSDomains (if any are
+	// set) and not under ExcludedDNSDomains. The extension is marked critical.
+	PermittedDNSDomains []string
+	ExcludedDNSDomains  []string
+	// Don't generate a client cert; Certs.Client will be nil.
+	SkipClient bool
+	// Generate an intermediate CA signed by the root, and sign the leaf and
+	// client certs with the intermediate instead of the root. The
+	// intermediate is valid for IntermediateValidFor.
+	Intermediate bool
+	// Only generate the intermediate CA, not the leaf and client certs, e.g.
+	// to mint a new intermediate from an offline root loaded from disk.
+	// Certs.Leaf and Certs.Client will be nil.
+	IntermediateOnly bool
+	// PEM encoded root CA private key to use instead of reading
+	// RootCAPrivateKey from disk. Takes precedence over RootCAPrivateKey.
+	RootCAPrivateKeyPEM []byte
+	// PEM encoded root CA certificate to use instead of reading RootCACert
+	// from disk. Takes precedence over RootCACert. As with the file path
+	// fields, the certificate and private key must be set together.
+	RootCACertPEM []byte
+	// An already parsed root CA certificate and its signer, e.g. one backed
+	// by a KMS or HSM so the private key is never in memory, to use instead
+	// of any of the PEM or file path fields. They must be set together. The
+	// returned Certs.Root has no private key.
+	RootCertificate *x509.Certificate
+	RootSigner      crypto.Signer
+	// Password to decrypt the root CA private key with, if it's an encrypted
+	// PKCS#8 ("ENCRYPTED PRIVATE KEY") block, e.g. one written with
+	// KeyPassword set.
+	RootCAKeyPassword string
+	// Add the critical certificate transparency poison extension (RFC 6962,
+	// section 3.1) to the leaf cert, making it a precertificate that can be
+	// submitted to a CT log. Precertificates are not accepted by TLS clients.
+	CTPoison bool
+	// Add the OCSP Must-Staple TLS Feature extension (RFC 7633) to the leaf
+	// cert, so clients that support it require the server to staple an OCSP
+	// response. Only set this if the server staples, or clients that enforce
+	// it will reject the connection.
+	MustStaple bool
+	// Whether to mark the Basic Constraints extension critical on the leaf
+	// and client certs. By default it's critical on every cert, as Go's x509
+	// package writes it. Marking it non-critical lets verifiers that don't
+	// understand it ignore it, so only set this to false for devices that
+	// reject a critical Basic Constraints extension on leaf certs. It's
+	// always critical on CA certs, as RFC 5280 requires.
+	BasicConstraintsCritical *bool
+	// Extra extensions to add to the leaf and client certs, e.g. vendor
+	// specific device identity extensions. They override any extension with
+	// the same ID that would otherwise be generated. Note that verifiers
+	// reject certs with critical extensions they don't understand.
+	ExtraLeafExtensions   []pkix.Extension
+	ExtraClientExtensions []pkix.Extension
+	// Certificate policy OIDs to put on the leaf and client certs, as dotted
+	// strings like "2.23.140.1.2.1".
+	PolicyOIDs []string
+	// Make the leaf cert a CA, with the KeyUsageCertSign key usage, so it can
+	// sign further certs. The issuer's path length constraint must allow
+	// another CA below it.
+	LeafIsCA bool
 }
 
-func Generate(cfg Config) (*Certs, error) {
-	if cfg.RootCACert != "" && cfg.RootCAPrivateKey == "" {
-		return nil, errors.New("gencert: must set both RootCACert and RootCAPrivateKey, or neither")
-	}
-	if cfg.RootCACert == "" && cfg.RootCAPrivateKey != "" {
-		return nil, errors.New("gencert: must set both RootCACert and RootCAPrivateKey, or neither")
+// logDebug logs msg to cfg.Logger, if it's set.
+func (cfg Config) logDebug(ctx context.Context, msg string, args ...any) {
+	if cfg.Logger != nil {
+		cfg.Logger.DebugContext(ctx, msg, args...)
 	}
-	if cfg.RootCACert != "" && cfg.RootValidFor != 0 {
-		return nil, errors.New("gencert: cannot set RootValidFor when loading root cert from disk")
+}
+
+// certAttrs returns log attributes describing c.
+func certAttrs(c *Cert) []any {
+	return []any{
+		slog.String("serial", c.Certificate.SerialNumber.String()),
+		slog.String("subject", c.Certificate.Subject.String()),
+		slog.Time("not_after", c.NotAfter),
 	}
-	if cfg.RootValidFor == 0 {
-		cfg.RootValidFor = 365 * 24 * time.Hour
+}
+
+// oidCTPoison identifies the certificate transparency precertificate poison
+// extension.
+var oidCTPoison = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+
+// oidTLSFeature identifies the TLS Feature extension, and tlsFeatureStatusRequest
+// is the status_request feature that marks a cert as Must-Staple.
+var oidTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+const tlsFeatureStatusRequest = 5
+
+// oidBasicConstraints identifies the Basic Constraints extension.
+var oidBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+
+// basicConstraintsExtension returns the Basic Constraints extension that Go
+// would write for template, but with the given criticality.
+func basicConstraintsExtension(template *x509.Certificate, critical bool) (pkix.Extension, error) {
+	bc := struct {
+		IsCA       bool `asn1:"optional"`
+		MaxPathLen int  `asn1:"optional,default:-1"`
+	}{IsCA: template.IsCA, MaxPathLen: template.MaxPathLen}
+	if bc.MaxPathLen == 0 && !template.MaxPathLenZero {
+		bc.MaxPathLen = -1
 	}
-	if cfg.LeafValidFor == 0 {
-		cfg.LeafValidFor = 365 * 24 * time.Hour
+	value, err := asn1.Marshal(bc)
+	if err != nil {
+		return pkix.Extension{}, err
 	}
-	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	notBefore := time.Now().UTC()
-	leafNotAfter := notBefore.Add(cfg.LeafValidFor)
+	return pkix.Extension{Id: oidBasicConstraints, Critical: critical, Value: value}, nil
+}
 
-	leafSerialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+// endEntityTemplate returns the template shared by leaf and client certs.
+func (cfg Config) endEntityTemplate(serial *big.Int) (*x509.Certificate, error) {
+	serialNumber, err := cfg.serialNumber(serial)
 	if err != nil {
-		log.Fatalf("failed to generate serial number: %s", err)
+		return nil, err
 	}
-	leafTemplate := x509.Certificate{
+	notBefore := cfg.NotBefore.UTC()
+	template := &x509.Certificate{
 		IsCA:         false,
-		SerialNumber: leafSerialNumber,
-		Subject: pkix.Name{
-			Organization: []string{cfg.Org},
-			SerialNumber: leafSerialNumber.String(),
-		},
-		NotBefore: notBefore,
-		NotAfter:  leafNotAfter,
-
-		KeyUsage: x509.KeyUsageDigitalSignature,
-		ExtKeyUsage: []x509.ExtKeyUsage{
-			x509.ExtKeyUsageServerAuth,
-		},
+		SerialNumber: serialNumber,
+		Subject:      cfg.subject(cfg.CommonName, serialNumber),
+		NotBefore:    notBefore,
+		NotAfter:     cfg.leafNotAfter(),
+
+		KeyUsage:              x509.KeyUsageDigitalSignature,
 		BasicConstraintsValid: true,
+		SignatureAlgorithm:    cfg.SignatureAlgorithm,
+
+		OCSPServer:            cfg.OCSPServer,
+		CRLDistributionPoints: cfg.CRLDistributionPoints,
+		IssuingCertificateURL: cfg.IssuingCertificateURL,
+	}
+	if cfg.EmptySubject {
+		template.Subject = pkix.Name{}
+	}
+	for _, s := range cfg.PolicyOIDs {
+		oid, err := x509.ParseOID(s)
+		if err != nil {
+			return nil, fmt.Errorf("gencert: invalid policy OID %q: %v", s, err)
+		}
+		template.Policies = append(template.Policies, oid)
 	}
+	names, err := cfg.sans()
+	if err != nil {
+		return nil, err
+	}
+	names.apply(template)
+	return template, nil
+}
 
-	clientSerialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+// leafTemplate returns the template for the leaf (server) cert.
+func (cfg Config) leafTemplate() (*x509.Certificate, error) {
+	template, err := cfg.endEntityTemplate(cfg.LeafSerial)
 	if err != nil {
-		log.Fatalf("failed to generate serial number: %s", err)
+		return nil, err
 	}
-	clientTemplate := x509.Certificate{
-		IsCA:         false,
-		SerialNumber: clientSerialNumber,
-		Subject: pkix.Name{
-			Organization: []string{cfg.Org},
-			SerialNumber: clientSerialNumber.String(),
-		},
-		NotBefore: notBefore,
-		NotAfter:  leafNotAfter,
-
-		KeyUsage: x509.KeyUsageDigitalSignature,
-		ExtKeyUsage: []x509.ExtKeyUsage{
-			x509.ExtKeyUsageClientAuth,
-		},
-		BasicConstraintsValid: true,
+	template.ExtKeyUsage = []x509.ExtKeyUsage{
+		x509.ExtKeyUsageServerAuth,
+	}
+	if cfg.DualUsage {
+		template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+	}
+	if cfg.LeafKeyUsage != 0 {
+		template.KeyUsage = cfg.LeafKeyUsage
+	}
+	if len(cfg.LeafExtKeyUsage) > 0 {
+		template.ExtKeyUsage = cfg.LeafExtKeyUsage
+	}
+	if cfg.CTPoison {
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+			Id:       oidCTPoison,
+			Critical: true,
+			Value:    asn1.NullBytes,
+		})
 	}
+	if cfg.MustStaple {
+		value, err := asn1.Marshal([]int{tlsFeatureStatusRequest})
+		if err != nil {
+			return nil, err
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+			Id:    oidTLSFeature,
+			Value: value,
+		})
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, cfg.ExtraLeafExtensions...)
+	if cfg.LeafIsCA {
+		template.IsCA = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+	return template, nil
+}
+
+// checkLeafIsCA returns an error if cfg makes the leaf a CA, but the path
+// length constraint on issuer doesn't allow any more CAs below it.
+func (cfg Config) checkLeafIsCA(issuer *x509.Certificate) error {
+	if cfg.LeafIsCA && issuer.MaxPathLen == 0 && issuer.MaxPathLenZero {
+		return errors.New("gencert: cannot issue a CA leaf cert, the issuer's path length constraint is zero")
+	}
+	return nil
+}
+
+// clientTemplate returns the template for the client cert.
+func (cfg Config) clientTemplate() (*x509.Certificate, error) {
+	template, err := cfg.endEntityTemplate(cfg.ClientSerial)
+	if err != nil {
+		return nil, err
+	}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{
+		x509.ExtKeyUsageClientAuth,
+	}
+	if cfg.ClientValidFor != 0 {
+		template.NotAfter = cfg.NotBefore.UTC().Add(cfg.ClientValidFor)
+	}
+	if cfg.ClientKeyUsage != 0 {
+		template.KeyUsage = cfg.ClientKeyUsage
+	}
+	if len(cfg.ClientExtKeyUsage) > 0 {
+		template.ExtKeyUsage = cfg.ClientExtKeyUsage
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, cfg.ExtraClientExtensions...)
+	return template, nil
+}
+
+// withDefaults returns a copy of cfg with defaults filled in for any unset
+// fields.
+func (cfg Config) withDefaults() Config {
+	if cfg.RootValidFor == 0 {
+		cfg.RootValidFor = 365 * 24 * time.Hour
+	}
+	if cfg.IntermediateValidFor == 0 {
+		cfg.IntermediateValidFor = cfg.RootValidFor
+	}
+	if cfg.LeafValidFor == 0 && cfg.LeafNotAfter.IsZero() {
+		cfg.LeafValidFor = 365 * 24 * time.Hour
+	}
+	if cfg.NotBefore.IsZero() {
+		cfg.NotBefore = time.Now().Add(-cfg.Backdate)
+	}
+	if cfg.CommonName == "" && len(cfg.Hosts) > 0 {
+		// an invalid host is reported by Validate
+		if names, err := cfg.sans(); err == nil {
+			cfg.CommonName = names.commonName
+		}
+	}
+	if cfg.Rand == nil {
+		cfg.Rand = rand.Reader
+	}
+	if cfg.Curve == nil {
+		cfg.Curve = elliptic.P256()
+	}
+	if cfg.RSABits == 0 {
+		cfg.RSABits = 2048
+	}
+	return cfg
+}
+
+// Resolved returns a copy of cfg with the defaults Generate would use filled
+// in, like the validity periods, NotBefore, CommonName, Curve and RSABits, and
+// with Org folded into Orgs, so callers can show what will be generated.
+// RootValidFor is left zero when cfg loads a root, so the resolved config can
+// still be passed to Generate.
+func (cfg Config) Resolved() Config {
+	cfg = cfg.withDefaults()
+	cfg.Orgs, cfg.Org = cfg.organizations(), ""
+	if cfg.loadsRoot() {
+		cfg.RootValidFor = 0
+	}
+	return cfg
+}
+
+// serialNumber returns serial if it's set, otherwise one from cfg.SerialFunc
+// or a random 128-bit serial number.
+func (cfg Config) serialNumber(serial *big.Int) (*big.Int, error) {
+	if serial != nil {
+		return serial, nil
+	}
+	if cfg.SerialFunc != nil {
+		serial, err := cfg.SerialFunc()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate serial number: %s", err)
+		}
+		if serial == nil || serial.Sign() <= 0 {
+			return nil, fmt.Errorf("gencert: SerialFunc returned %v, serial numbers must be positive", serial)
+		}
+		return serial, nil
+	}
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serial, err := rand.Int(cfg.Rand, serialNumberLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %s", err)
+	}
+	return serial, nil
+}
+
+// sans are the subject alternative names for a leaf or client cert.
+type sans struct {
+	dnsNames       []string
+	ipAddresses    []net.IP
+	emailAddresses []string
+	uris           []*url.URL
+	// The first DNS name or IP address from Hosts, normalized as it is in
+	// the SANs, for the default Common Name.
+	commonName string
+}
 
+// sans sorts the Hosts, EmailAddresses and URIs in cfg into subject
+// alternative names.
+func (cfg Config) sans() (*sans, error) {
+	names := new(sans)
+	for _, u := range cfg.URIs {
+		uri, err := url.Parse(u)
+		if err != nil {
+			return nil, fmt.Errorf("gencert: could not parse URI %q: %v", u, err)
+		}
+		if !uri.IsAbs() {
+			return nil, fmt.Errorf("gencert: URI %q must be absolute", u)
+		}
+		names.uris = append(names.uris, uri)
+	}
+	names.emailAddresses = append(names.emailAddresses, cfg.EmailAddresses...)
+	var invalid []string
 	for _, h := range cfg.Hosts {
+		h = strings.TrimSpace(h)
+		if strings.HasPrefix(h, "[") && strings.HasSuffix(h, "]") {
+			h = h[1 : len(h)-1]
+		}
 		if ip := net.ParseIP(h); ip != nil {
-			leafTemplate.IPAddresses = append(leafTemplate.IPAddresses, ip)
-			clientTemplate.IPAddresses = append(clientTemplate.IPAddresses, ip)
+			names.ipAddresses = append(names.ipAddresses, ip)
+			if names.commonName == "" {
+				names.commonName = ip.String()
+			}
+			if cfg.IPAsDNS {
+				names.dnsNames = append(names.dnsNames, ip.String())
+			}
+		} else if _, _, err := net.ParseCIDR(h); err == nil {
+			return nil, fmt.Errorf("gencert: host %q is a CIDR range, but certs can only hold single IP addresses; list each address instead", h)
+		} else if strings.Contains(h, "@") {
+			names.emailAddresses = append(names.emailAddresses, h)
 		} else {
-			leafTemplate.DNSNames = append(leafTemplate.DNSNames, h)
-			clientTemplate.DNSNames = append(clientTemplate.DNSNames, h)
+			name, err := toASCII(h)
+			if err != nil {
+				return nil, err
+			}
+			if !validDNSName(name) {
+				invalid = append(invalid, h)
+				continue
+			}
+			names.dnsNames = append(names.dnsNames, name)
+			if names.commonName == "" {
+				names.commonName = name
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("gencert: invalid hosts: %q", invalid)
+	}
+	return names, nil
+}
+
+// toASCII converts an internationalized domain name like
+// "münchen.example.com" to its punycode form, mapping it the way a resolver
+// would first, e.g. lowercasing it and replacing fullwidth characters, so the
+// cert matches the name clients look up. ASCII names are returned unchanged.
+func toASCII(name string) (string, error) {
+	ascii := true
+	for i := 0; i < len(name); i++ {
+		if name[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return name, nil
+	}
+	wildcard := strings.HasPrefix(name, "*.")
+	converted, err := idna.Lookup.ToASCII(strings.TrimPrefix(name, "*."))
+	if err != nil {
+		return "", fmt.Errorf("gencert: could not convert host %q to punycode: %v", name, err)
+	}
+	if wildcard {
+		converted = "*." + converted
+	}
+	return converted, nil
+}
+
+// validDNSName reports whether name is a valid DNS name per the RFC 1035
+// label rules (as relaxed by RFC 1123 to allow leading digits), optionally
+// with a leading "*." wildcard label.
+func validDNSName(name string) bool {
+	name = strings.TrimPrefix(name, "*.")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-') {
+				return false
+			}
 		}
 	}
+	return true
+}
+
+// apply adds the names in s to template.
+func (s *sans) apply(template *x509.Certificate) {
+	template.DNSNames = append(template.DNSNames, s.dnsNames...)
+	template.IPAddresses = append(template.IPAddresses, s.ipAddresses...)
+	template.EmailAddresses = append(template.EmailAddresses, s.emailAddresses...)
+	template.URIs = append(template.URIs, s.uris...)
+}
 
+// subject returns the distinguished name for a cert with the given common name
+// and serial number. serialNumber may be nil, e.g. for a CSR.
+func (cfg Config) subject(commonName string, serialNumber *big.Int) pkix.Name {
+	name := pkix.Name{
+		CommonName:         commonName,
+		Country:            cfg.Country,
+		Province:           cfg.Province,
+		Locality:           cfg.Locality,
+		Organization:       cfg.organizations(),
+		OrganizationalUnit: cfg.OrganizationalUnit,
+	}
+	if serialNumber != nil && !cfg.NoSubjectSerial {
+		name.SerialNumber = serialNumber.String()
+	}
+	return name
+}
+
+// leafNotAfter returns when leaf and client certs should expire.
+func (cfg Config) leafNotAfter() time.Time {
+	if !cfg.LeafNotAfter.IsZero() {
+		return cfg.LeafNotAfter.UTC()
+	}
+	return cfg.NotBefore.UTC().Add(cfg.LeafValidFor)
+}
+
+// organizations returns the Organization values for the subject: Orgs,
+// followed by Org if it's set.
+func (cfg Config) organizations() []string {
+	if len(cfg.Orgs) == 0 {
+		return []string{cfg.Org}
+	}
+	orgs := append([]string(nil), cfg.Orgs...)
+	if cfg.Org != "" {
+		orgs = append(orgs, cfg.Org)
+	}
+	return orgs
+}
+
+// caSubject returns the subject for the root and intermediate CA certs, which
+// use RootOrg instead of Org if it's set.
+func (cfg Config) caSubject(serialNumber *big.Int) pkix.Name {
+	name := cfg.subject("", serialNumber)
+	if cfg.RootOrg != "" {
+		name.Organization = []string{cfg.RootOrg}
+	}
+	return name
+}
+
+// loadsRoot reports whether cfg specifies an existing root CA, instead of
+// asking for a new one to be generated.
+func (cfg Config) loadsRoot() bool {
+	return cfg.RootCAPrivateKey != "" || cfg.RootCAPrivateKeyPEM != nil || cfg.RootSigner != nil
+}
+
+// checkRootPair returns ErrMissingRootPair if only one of the root CA
+// certificate and private key is set.
+func (cfg Config) checkRootPair() error {
+	if (cfg.RootCertificate != nil) != (cfg.RootSigner != nil) {
+		return errors.New("gencert: must set both RootCertificate and RootSigner, or neither")
+	}
+	hasRootCert := cfg.RootCACert != "" || cfg.RootCACertPEM != nil
+	hasRootKey := cfg.RootCAPrivateKey != "" || cfg.RootCAPrivateKeyPEM != nil
+	if hasRootCert != hasRootKey {
+		return ErrMissingRootPair
+	}
+	return nil
+}
+
+// Validate checks cfg for mistakes that would cause Generate to fail, like
+// setting only half of the root CA pair or passing an invalid host, without
+// generating any keys or certs. Every function that issues certs or CSRs from
+// a Config calls it first.
+func (cfg Config) Validate() error {
+	if err := cfg.checkSettings(); err != nil {
+		return err
+	}
+	if !cfg.IntermediateOnly && len(cfg.Hosts) == 0 && len(cfg.EmailAddresses) == 0 && len(cfg.URIs) == 0 && (cfg.CommonName == "" || cfg.EmptySubject) {
+		return ErrNoIdentity
+	}
+	_, err := cfg.sans()
+	return err
+}
+
+// checkSettings does the checks in Validate that don't depend on the hosts
+// and other names in cfg, for SignCSR, which takes them from the CSR instead.
+func (cfg Config) checkSettings() error {
+	if err := cfg.checkRootPair(); err != nil {
+		return err
+	}
+	if cfg.loadsRoot() && cfg.RootValidFor != 0 {
+		return ErrRootValidFor
+	}
+	if cfg.LeafValidFor != 0 && !cfg.LeafNotAfter.IsZero() {
+		return errors.New("gencert: cannot set both LeafValidFor and LeafNotAfter")
+	}
+	if !cfg.LeafNotAfter.IsZero() && !cfg.NotBefore.IsZero() && !cfg.LeafNotAfter.After(cfg.NotBefore) {
+		return errors.New("gencert: LeafNotAfter must be after NotBefore")
+	}
+	if cfg.StrictValidity {
+		if err := cfg.CheckLeafValidity(); err != nil {
+			return err
+		}
+	}
+	if cfg.ClientValidFor < 0 {
+		return errors.New("gencert: ClientValidFor cannot be negative")
+	}
+	if cfg.Backdate < 0 {
+		return errors.New("gencert: Backdate cannot be negative")
+	}
+	if cfg.LegacyKeyFormat && cfg.KeyPassword != "" {
+		return errors.New("gencert: cannot set both LegacyKeyFormat and KeyPassword")
+	}
+	if cfg.KeyType < KeyECDSA || cfg.KeyType > KeyEd25519 {
+		return fmt.Errorf("gencert: unknown key type %d", cfg.KeyType)
+	}
+	if cfg.KeyType == KeyRSA && cfg.RSABits != 0 && cfg.RSABits < cfg.minRSABits() {
+		return fmt.Errorf("gencert: %d-bit RSA keys are too small, must be at least %d bits", cfg.RSABits, cfg.minRSABits())
+	}
+	if cfg.KeyType == KeyECDSA && cfg.Curve != nil && cfg.Curve.Params().BitSize < 256 {
+		return fmt.Errorf("gencert: curve %s is too weak, must be at least P-256", cfg.Curve.Params().Name)
+	}
+	if cfg.SignatureAlgorithm != x509.UnknownSignatureAlgorithm {
+		kt, ok := signatureKeyType(cfg.SignatureAlgorithm)
+		if !ok {
+			return fmt.Errorf("gencert: unsupported signature algorithm %v", cfg.SignatureAlgorithm)
+		}
+		// a loaded root signs with its own key, which is checked when it's
+		// loaded, but generated roots and intermediates sign with KeyType
+		// keys.
+		generatedSigner := !cfg.loadsRoot() || (cfg.Intermediate && !cfg.IntermediateOnly)
+		if kt != cfg.KeyType && generatedSigner {
+			return fmt.Errorf("gencert: signature algorithm %v cannot be used with %s keys", cfg.SignatureAlgorithm, cfg.KeyType)
+		}
+	}
+	for _, s := range cfg.PolicyOIDs {
+		if _, err := x509.ParseOID(s); err != nil {
+			return fmt.Errorf("gencert: invalid policy OID %q: %v", s, err)
+		}
+	}
+	return nil
+}
+
+// minRSABits returns cfg.MinRSABits, or its default.
+func (cfg Config) minRSABits() int {
+	if cfg.MinRSABits == 0 {
+		return 2048
+	}
+	return cfg.MinRSABits
+}
+
+// checkKeyStrength returns an error if pub is an RSA key smaller than
+// MinRSABits, or an ECDSA key on a curve weaker than P-256. Validate checks
+// the keys cfg asks for; this checks the keys that are actually generated or
+// loaded, including root CA keys.
+func (cfg Config) checkKeyStrength(pub crypto.PublicKey) error {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if bits := k.N.BitLen(); bits < cfg.minRSABits() {
+			return fmt.Errorf("gencert: %d-bit RSA keys are too small, must be at least %d bits", bits, cfg.minRSABits())
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve.Params().BitSize < 256 {
+			return fmt.Errorf("gencert: curve %s is too weak, must be at least P-256", k.Curve.Params().Name)
+		}
+	}
+	return nil
+}
+
+// CheckLeafValidity returns an error wrapping ErrLeafValidForTooLong if the
+// leaf cert would be valid for longer than MaxLeafValidFor, and so be rejected
+// by browsers. Generate only enforces this when StrictValidity is set.
+func (cfg Config) CheckLeafValidity() error {
+	cfg = cfg.withDefaults()
+	validFor := cfg.leafNotAfter().Sub(cfg.NotBefore.UTC())
+	if validFor > MaxLeafValidFor {
+		return fmt.Errorf("%w (got %s)", ErrLeafValidForTooLong, validFor.Round(time.Second))
+	}
+	return nil
+}
+
+// loadRoot reads the root CA certificate and private key specified in cfg,
+// preferring RootCertificate and RootSigner, then the in-memory PEM fields, to
+// the file paths.
+func loadRoot(cfg Config) (*Cert, *x509.Certificate, crypto.Signer, error) {
+	if cfg.RootSigner != nil {
+		return signerRoot(cfg)
+	}
+	certdata, certName := cfg.RootCACertPEM, "RootCACertPEM"
+	if certdata == nil {
+		var err error
+		certdata, err = ioutil.ReadFile(cfg.RootCACert)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		certName = cfg.RootCACert
+	}
+	certBlock, _ := pem.Decode(certdata)
+	if certBlock == nil {
+		return nil, nil, nil, fmt.Errorf("could not decode %q as PEM encoded CA certificate", certName)
+	}
+	rootTemplate, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	keydata, keyName := cfg.RootCAPrivateKeyPEM, "RootCAPrivateKeyPEM"
+	if keydata == nil {
+		keydata, err = ioutil.ReadFile(cfg.RootCAPrivateKey)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		keyName = cfg.RootCAPrivateKey
+	}
+	keyBlock, _ := pem.Decode(keydata)
+	if keyBlock == nil {
+		return nil, nil, nil, fmt.Errorf("could not decode %q as PEM encoded CA private key", keyName)
+	}
+	parseBlock := keyBlock
+	if keyBlock.Type == "ENCRYPTED PRIVATE KEY" {
+		if cfg.RootCAKeyPassword == "" {
+			return nil, nil, nil, fmt.Errorf("%q is encrypted, but no root CA key password was set", keyName)
+		}
+		der, err := decryptPKCS8(keyBlock.Bytes, cfg.RootCAKeyPassword)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		parseBlock = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	key, err := parsePrivateKey(parseBlock)
+	if err != nil {
+		if parseBlock != keyBlock {
+			return nil, nil, nil, errWrongPassword
+		}
+		return nil, nil, nil, err
+	}
+	if err := cfg.checkKeyStrength(key.Public()); err != nil {
+		return nil, nil, nil, fmt.Errorf("root CA key: %w", err)
+	}
+	if cfg.SignatureAlgorithm != x509.UnknownSignatureAlgorithm {
+		if err := checkSignatureAlgorithm(cfg.SignatureAlgorithm, key); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	parsed := rootTemplate
+	rootTemplate, err = issuerTemplate(parsed)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	root := &Cert{
+		Private:      keyBlock,
+		Public:       certBlock,
+		PrivateBytes: pem.EncodeToMemory(keyBlock),
+		PublicBytes:  pem.EncodeToMemory(certBlock),
+		PrivateDER:   keyBlock.Bytes,
+		PublicDER:    certBlock.Bytes,
+		NotBefore:    parsed.NotBefore,
+		NotAfter:     parsed.NotAfter,
+		Certificate:  parsed,
+	}
+	return root, rootTemplate, key, nil
+}
+
+// signerRoot returns the root CA in cfg.RootCertificate and cfg.RootSigner.
+func signerRoot(cfg Config) (*Cert, *x509.Certificate, crypto.Signer, error) {
+	cert, signer := cfg.RootCertificate, cfg.RootSigner
+	if len(cert.Raw) == 0 {
+		return nil, nil, nil, errors.New("gencert: RootCertificate must be a parsed certificate")
+	}
+	if pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); ok && !pub.Equal(cert.PublicKey) {
+		return nil, nil, nil, errors.New("gencert: RootSigner's public key does not match RootCertificate")
+	}
+	if err := cfg.checkKeyStrength(signer.Public()); err != nil {
+		return nil, nil, nil, fmt.Errorf("root CA key: %w", err)
+	}
+	if cfg.SignatureAlgorithm != x509.UnknownSignatureAlgorithm {
+		if err := checkSignatureAlgorithm(cfg.SignatureAlgorithm, signer); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	template, err := issuerTemplate(cert)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	certBlock := &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}
+	root := &Cert{
+		Public:      certBlock,
+		PublicBytes: pem.EncodeToMemory(certBlock),
+		PublicDER:   cert.Raw,
+		NotBefore:   cert.NotBefore,
+		NotAfter:    cert.NotAfter,
+		Certificate: cert,
+	}
+	return root, template, signer, nil
+}
+
+// issuerTemplate returns the template to sign certs with the existing CA
+// cert. Older roots may not have a Subject Key Identifier, but certs we sign
+// with them should still get an Authority Key Identifier, so it's set on a
+// copy, leaving cert matching what's on disk.
+func issuerTemplate(cert *x509.Certificate) (*x509.Certificate, error) {
+	if len(cert.SubjectKeyId) > 0 {
+		return cert, nil
+	}
+	withKeyID := *cert
+	var err error
+	withKeyID.SubjectKeyId, err = subjectKeyID(cert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &withKeyID, nil
+}
+
+// Generate creates a root CA (or loads one, if cfg specifies it) and uses it
+// to sign a leaf and client cert.
+func Generate(cfg Config) (*Certs, error) {
+	return GenerateContext(context.Background(), cfg)
+}
+
+// GenerateContext is like Generate, but stops and returns ctx.Err() if ctx is
+// canceled between generating the root, intermediate, leaf and client certs.
+func GenerateContext(ctx context.Context, cfg Config) (*Certs, error) {
+	certs, _, _, err := generate(ctx, cfg)
+	return certs, err
+}
+
+// generate does the work of GenerateContext, additionally returning the
+// template and key of the CA that signed the leaf and client certs.
+func generate(ctx context.Context, cfg Config) (*Certs, *x509.Certificate, crypto.Signer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, nil, err
+	}
+	cfg = cfg.withDefaults()
+	notBefore := cfg.NotBefore.UTC()
+	var leafTemplate, clientTemplate *x509.Certificate
+	var err error
+	if !cfg.IntermediateOnly {
+		leafTemplate, err = cfg.leafTemplate()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		clientTemplate, err = cfg.clientTemplate()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
 	var root *Cert
-	var key *ecdsa.PrivateKey
+	var key crypto.Signer
 	var rootTemplate *x509.Certificate
-	if cfg.RootCAPrivateKey == "" {
-		serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if !cfg.loadsRoot() {
+		serialNumber, err := cfg.serialNumber(cfg.RootSerial)
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate serial number: %s", err)
+			return nil, nil, nil, err
 		}
 		rootNotAfter := notBefore.Add(cfg.RootValidFor)
 		rootTemplate = &x509.Certificate{
 			IsCA:         true,
 			SerialNumber: serialNumber,
-			Subject: pkix.Name{
-				Organization: []string{cfg.Org},
-				SerialNumber: serialNumber.String(),
-			},
-			NotBefore: notBefore,
-			NotAfter:  rootNotAfter,
+			Subject:      cfg.caSubject(serialNumber),
+			NotBefore:    notBefore,
+			NotAfter:     rootNotAfter,
 
-			KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 			ExtKeyUsage: []x509.ExtKeyUsage{
 				x509.ExtKeyUsageServerAuth,
 				x509.ExtKeyUsageClientAuth,
 			},
 			BasicConstraintsValid: true,
+			SignatureAlgorithm:    cfg.SignatureAlgorithm,
+			MaxPathLen:            cfg.MaxPathLen,
+			MaxPathLenZero:        cfg.MaxPathLenZero,
+
+			PermittedDNSDomains:         cfg.PermittedDNSDomains,
+			ExcludedDNSDomains:          cfg.ExcludedDNSDomains,
+			PermittedDNSDomainsCritical: len(cfg.PermittedDNSDomains) > 0 || len(cfg.ExcludedDNSDomains) > 0,
+		}
+		if cfg.RootCommonName != "" {
+			rootTemplate.Subject.CommonName = cfg.RootCommonName
+		}
+		if cfg.RootNoEKU {
+			rootTemplate.ExtKeyUsage = nil
 		}
 
-		root, key, err = genCert(rootTemplate, rootTemplate, nil)
+		root, key, err = genCert(cfg, rootTemplate, rootTemplate, nil, nil)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
+		cfg.logDebug(ctx, "generated root CA", certAttrs(root)...)
 	} else {
-		certdata, err := ioutil.ReadFile(cfg.RootCACert)
+		root, rootTemplate, key, err = loadRoot(cfg)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
-		var certBlock *pem.Block
-		certBlock, _ = pem.Decode(certdata)
-		if certBlock == nil {
-			return nil, fmt.Errorf("could not decode %q as PEM encoded CA certificate", cfg.RootCACert)
+		cfg.logDebug(ctx, "loaded root CA", certAttrs(root)...)
+	}
+	// the leaf and client are signed by the intermediate, if there is one
+	var intermediate *Cert
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	issuerTemplate, issuerKey := rootTemplate, key
+	if cfg.Intermediate || cfg.IntermediateOnly {
+		serialNumber, err := cfg.serialNumber(nil)
+		if err != nil {
+			return nil, nil, nil, err
 		}
+		intermediateTemplate := &x509.Certificate{
+			IsCA:         true,
+			SerialNumber: serialNumber,
+			Subject:      cfg.caSubject(serialNumber),
+			NotBefore:    notBefore,
+			NotAfter:     notBefore.Add(cfg.IntermediateValidFor),
 
-		rootTemplate, err = x509.ParseCertificate(certBlock.Bytes)
+			KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+			ExtKeyUsage: []x509.ExtKeyUsage{
+				x509.ExtKeyUsageServerAuth,
+				x509.ExtKeyUsageClientAuth,
+			},
+			BasicConstraintsValid: true,
+			SignatureAlgorithm:    cfg.SignatureAlgorithm,
+			MaxPathLenZero:        true,
+		}
+		intermediate, issuerKey, err = genCert(cfg, intermediateTemplate, rootTemplate, key, nil)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
-		keydata, err := ioutil.ReadFile(cfg.RootCAPrivateKey)
+		cfg.logDebug(ctx, "generated intermediate CA", certAttrs(intermediate)...)
+		issuerTemplate = intermediateTemplate
+	}
+	if cfg.IntermediateOnly {
+		certs := &Certs{Root: root, Intermediate: intermediate}
+		return certs, issuerTemplate, issuerKey, nil
+	}
+	if err := cfg.checkLeafIsCA(issuerTemplate); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	// the leaf and client don't depend on each other, so generate them
+	// concurrently
+	var leaf, client *Cert
+	g, gctx := errgroup.WithContext(ctx)
+	if cfg.Rand != rand.Reader {
+		// custom readers may not be safe for concurrent use, and sharing
+		// one between goroutines would make the output nondeterministic.
+		g.SetLimit(1)
+	}
+	g.Go(func() error {
+		var err error
+		leaf, _, err = genCert(cfg, leafTemplate, issuerTemplate, issuerKey, nil)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		var keyBlock *pem.Block
-		keyBlock, _ = pem.Decode(keydata)
-		if keyBlock == nil {
-			return nil, fmt.Errorf("could not decode %q as PEM encoded CA certificate", cfg.RootCAPrivateKey)
+		cfg.logDebug(ctx, "signed leaf cert", certAttrs(leaf)...)
+		return nil
+	})
+	if !cfg.SkipClient {
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			var err error
+			client, _, err = genCert(cfg, clientTemplate, issuerTemplate, issuerKey, nil)
+			if err != nil {
+				return err
+			}
+			cfg.logDebug(ctx, "signed client cert", certAttrs(client)...)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, nil, nil, err
+	}
+	certs := &Certs{
+		Root:         root,
+		Intermediate: intermediate,
+		Leaf:         leaf,
+		Client:       client,
+	}
+	return certs, issuerTemplate, issuerKey, nil
+}
+
+// parsePrivateKey parses a PKCS#8, PKCS#1 ("RSA PRIVATE KEY") or SEC1 ("EC
+// PRIVATE KEY") encoded private key, depending on the type of the PEM block.
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	rawKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := rawKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("could not use private key of type %T as a crypto.Signer", rawKey)
+	}
+	return key, nil
+}
+
+// generateKey creates a new private key of the type specified in cfg.
+func generateKey(cfg Config) (crypto.Signer, error) {
+	switch cfg.KeyType {
+	case KeyECDSA:
+		key, err := ecdsa.GenerateKey(cfg.Curve, cfg.Rand)
+		if err != nil {
+			return nil, err
 		}
-		rawKey, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+		return key, nil
+	case KeyRSA:
+		key, err := rsa.GenerateKey(cfg.Rand, cfg.RSABits)
 		if err != nil {
 			return nil, err
 		}
-		var ok bool
-		key, ok = rawKey.(*ecdsa.PrivateKey)
-		if !ok {
-			return nil, fmt.Errorf("could not parse private key as a *ecdsa.PrivateKey, use other parsing format")
+		return key, nil
+	case KeyEd25519:
+		// read the seed ourselves, since ed25519.GenerateKey ignores
+		// custom readers
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := io.ReadFull(cfg.Rand, seed); err != nil {
+			return nil, err
 		}
-		root = &Cert{
-			Private:      keyBlock,
-			Public:       certBlock,
-			PrivateBytes: keyBlock.Bytes,
-			PublicBytes:  certBlock.Bytes,
+		return ed25519.NewKeyFromSeed(seed), nil
+	default:
+		return nil, fmt.Errorf("gencert: unknown key type %d", cfg.KeyType)
+	}
+}
+
+// encodePrivateKey marshals key into a PKCS#8 PEM block, encrypting it if
+// cfg.KeyPassword is set, or into a SEC1 or PKCS#1 block if
+// cfg.LegacyKeyFormat is set.
+func encodePrivateKey(cfg Config, key crypto.Signer) (*pem.Block, error) {
+	if cfg.LegacyKeyFormat {
+		switch k := key.(type) {
+		case *ecdsa.PrivateKey:
+			b, err := x509.MarshalECPrivateKey(k)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to marshal private key: %v", err)
+			}
+			return &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}, nil
+		case *rsa.PrivateKey:
+			return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}, nil
 		}
 	}
-	leaf, _, err := genCert(&leafTemplate, rootTemplate, key)
+	b, err := x509.MarshalPKCS8PrivateKey(key)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("Unable to marshal private key: %v", err)
+	}
+	if cfg.KeyPassword != "" {
+		block, err := encryptPKCS8(cfg.Rand, b, cfg.KeyPassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt private key: %v", err)
+		}
+		return block, nil
+	}
+	return &pem.Block{Type: "PRIVATE KEY", Bytes: b}, nil
+}
+
+// signatureKeyType returns the type of key that can sign with alg.
+func signatureKeyType(alg x509.SignatureAlgorithm) (KeyType, bool) {
+	switch alg {
+	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+		return KeyECDSA, true
+	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		return KeyRSA, true
+	case x509.PureEd25519:
+		return KeyEd25519, true
+	}
+	return 0, false
+}
+
+// checkSignatureAlgorithm returns an error if key can't sign with alg.
+func checkSignatureAlgorithm(alg x509.SignatureAlgorithm, key crypto.Signer) error {
+	var keyType KeyType
+	switch key.Public().(type) {
+	case *ecdsa.PublicKey:
+		keyType = KeyECDSA
+	case *rsa.PublicKey:
+		keyType = KeyRSA
+	case ed25519.PublicKey:
+		keyType = KeyEd25519
+	default:
+		// let CreateCertificate decide
+		return nil
+	}
+	if kt, ok := signatureKeyType(alg); !ok || kt != keyType {
+		return fmt.Errorf("gencert: signature algorithm %v cannot be used with the issuer's %s key", alg, keyType)
+	}
+	return nil
+}
+
+// signCert creates a certificate from template for the public key pub, signed
+// by signer on behalf of parent. Only the public half of the returned Cert
+// is populated.
+func signCert(cfg Config, template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) (*Cert, error) {
+	if cfg.BasicConstraintsCritical != nil && template.BasicConstraintsValid && !template.IsCA {
+		// CreateCertificate always marks the extension critical, but skips
+		// it if the template has its own
+		ext, err := basicConstraintsExtension(template, *cfg.BasicConstraintsCritical)
+		if err != nil {
+			return nil, err
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, ext)
+	}
+	derBytes, err := x509.CreateCertificate(cfg.Rand, template, parent, pub, signer)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create certificate: %s", err)
 	}
-	client, _, err := genCert(&clientTemplate, rootTemplate, key)
+	parsed, err := x509.ParseCertificate(derBytes)
 	if err != nil {
 		return nil, err
 	}
-	return &Certs{
-		Root:   root,
-		Leaf:   leaf,
-		Client: client,
-	}, nil
+	cert := new(Cert)
+	cert.NotBefore = parsed.NotBefore
+	cert.NotAfter = parsed.NotAfter
+	cert.Certificate = parsed
+	cert.Public = &pem.Block{Type: "CERTIFICATE", Bytes: derBytes}
+	cert.PublicDER = derBytes
+	cert.PublicBytes = pem.EncodeToMemory(cert.Public)
+	return cert, nil
 }
 
-func genCert(leaf *x509.Certificate, parent *x509.Certificate, signingKey *ecdsa.PrivateKey) (*Cert, *ecdsa.PrivateKey, error) {
-	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+// subjectKeyID computes a Subject Key Identifier for pub, as the SHA-1 hash of
+// the subjectPublicKey bit string (method 1 in RFC 5280, section 4.2.1.2).
+func subjectKeyID(pub crypto.PublicKey) ([]byte, error) {
+	spkiDER, err := x509.MarshalPKIXPublicKey(pub)
 	if err != nil {
+		return nil, err
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(spkiDER, &spki); err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum(spki.PublicKey.Bytes)
+	return sum[:], nil
+}
+
+// genCert issues a cert for template with key's public key, signed by signer
+// with parent as the issuer. The two keys are independent, so a leaf key of
+// any type can be signed by a CA key of any type; genCert only relies on
+// signer being a crypto.Signer. If template and parent are the same, the cert
+// is self-signed with key and signer must be nil. If key is nil a new one of
+// cfg.KeyType is generated.
+func genCert(cfg Config, template, parent *x509.Certificate, signer, key crypto.Signer) (*Cert, crypto.Signer, error) {
+	if key == nil {
+		var err error
+		key, err = generateKey(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := cfg.checkKeyStrength(key.Public()); err != nil {
 		return nil, nil, err
 	}
-	if leaf == parent {
-		if signingKey != nil {
+	if template == parent {
+		if signer != nil {
 			return nil, nil, fmt.Errorf("signing key must be nil when generating root cert")
 		}
-		signingKey = key
+		signer = key
+	}
+	if signer == nil {
+		return nil, nil, errors.New("gencert: no signing key for the cert")
+	}
+	if template.IsCA && len(template.SubjectKeyId) == 0 {
+		// set the key ID on the template instead of letting
+		// CreateCertificate generate one, so that certs signed using the
+		// template as their parent get a matching Authority Key Identifier.
+		var err error
+		template.SubjectKeyId, err = subjectKeyID(key.Public())
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	cert := new(Cert)
-	derBytes, err := x509.CreateCertificate(rand.Reader, leaf, parent, &key.PublicKey, signingKey)
+	cert, err := signCert(cfg, template, parent, key.Public(), signer)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Failed to create certificate: %s", err)
+		return nil, nil, err
 	}
-	cert.Public = &pem.Block{Type: "CERTIFICATE", Bytes: derBytes}
-	buf := new(bytes.Buffer)
-	if err := pem.Encode(buf, cert.Public); err != nil {
-		return nil, nil, fmt.Errorf("failed to write data to cert.pem: %s", err)
+	cert.Private, err = encodePrivateKey(cfg, key)
+	if err != nil {
+		return nil, nil, err
 	}
-	cert.PublicBytes = make([]byte, buf.Len())
-	copy(cert.PublicBytes, buf.Bytes())
-	buf.Reset()
+	cert.PrivateDER = cert.Private.Bytes
+	cert.PrivateBytes = pem.EncodeToMemory(cert.Private)
+	return cert, key, nil
+}
 
-	b, err := x509.MarshalPKCS8PrivateKey(key)
+// LeafConfig describes a leaf cert to issue with GenerateMany.
+type LeafConfig struct {
+	// Which hosts to sign the cert for, as in Config.Hosts.
+	Hosts []string
+	// Email addresses and URIs to add to the cert.
+	EmailAddresses []string
+	URIs           []string
+	// Which organization to issue the cert to, defaults to Config.Org and
+	// Config.Orgs.
+	Org string
+	// The Common Name to put on the cert, defaults to the first DNS name or
+	// IP address in Hosts, as for Config.CommonName.
+	CommonName string
+}
+
+// GenerateMany is like Generate, but also issues a leaf cert for each entry
+// in leafConfigs, all signed by the same root (or intermediate). This avoids
+// generating a new root for every leaf. All other settings, like the key type
+// and validity period, come from cfg.
+func GenerateMany(cfg Config, leafConfigs []LeafConfig) (*Certs, []*Cert, error) {
+	leafCfgs := make([]Config, len(leafConfigs))
+	for i, lc := range leafConfigs {
+		leafCfg := cfg
+		leafCfg.Hosts = lc.Hosts
+		leafCfg.EmailAddresses = lc.EmailAddresses
+		leafCfg.URIs = lc.URIs
+		leafCfg.CommonName = lc.CommonName
+		leafCfg.LeafSerial = nil
+		if lc.Org != "" {
+			leafCfg.Org = lc.Org
+			leafCfg.Orgs = nil
+		}
+		// check every leaf before generating anything
+		if err := leafCfg.Validate(); err != nil {
+			return nil, nil, fmt.Errorf("leaf config %d: %w", i, err)
+		}
+		leafCfgs[i] = leafCfg
+	}
+	certs, issuerTemplate, issuerKey, err := generate(context.Background(), cfg)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Unable to marshal ECDSA private key: %v", err)
+		return nil, nil, err
 	}
-	cert.Private = &pem.Block{Type: "PRIVATE KEY", Bytes: b}
-	if err := pem.Encode(buf, cert.Private); err != nil {
-		return nil, nil, fmt.Errorf("failed to encode key data: %s", err)
+	leaves := make([]*Cert, len(leafCfgs))
+	for i, leafCfg := range leafCfgs {
+		leafCfg = leafCfg.withDefaults()
+		template, err := leafCfg.leafTemplate()
+		if err != nil {
+			return nil, nil, err
+		}
+		leaves[i], _, err = genCert(leafCfg, template, issuerTemplate, issuerKey, nil)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
-	cert.PrivateBytes = make([]byte, buf.Len())
-	copy(cert.PrivateBytes, buf.Bytes())
-	return cert, key, nil
+	return certs, leaves, nil
 }
@@ -1,8 +1,36 @@
 package gencert
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
 )
 
 func TestMemoryCertMatch(t *testing.T) {
@@ -18,3 +46,2219 @@ func TestFromDiskCertMatch(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestGenerateRSA(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:   []string{"rsa.example.test"},
+		KeyType: KeyRSA,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certs.Leaf.PublicBytes, certs.Leaf.PrivateBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cert.PrivateKey.(*rsa.PrivateKey); !ok {
+		t.Errorf("expected *rsa.PrivateKey, got %T", cert.PrivateKey)
+	}
+}
+
+func TestGenerateEd25519(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:   []string{"ed25519.example.test"},
+		KeyType: KeyEd25519,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certs.Leaf.PublicBytes, certs.Leaf.PrivateBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cert.PrivateKey.(ed25519.PrivateKey); !ok {
+		t.Errorf("expected ed25519.PrivateKey, got %T", cert.PrivateKey)
+	}
+}
+
+func TestGenerateCurve(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts: []string{"p384.example.test"},
+		Curve: elliptic.P384(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certs.Leaf.PublicBytes)
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		t.Fatalf("expected *ecdsa.PublicKey, got %T", leaf.PublicKey)
+	}
+	if pub.Curve != elliptic.P384() {
+		t.Errorf("expected curve P-384, got %s", pub.Curve.Params().Name)
+	}
+}
+
+func TestKeySizeMinimums(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"rsa 1024", Config{KeyType: KeyRSA, RSABits: 1024}, true},
+		{"rsa 1024 allowed", Config{KeyType: KeyRSA, RSABits: 1024, MinRSABits: 1024}, false},
+		{"rsa 2048 below minimum", Config{KeyType: KeyRSA, RSABits: 2048, MinRSABits: 3072}, true},
+		{"rsa default", Config{KeyType: KeyRSA}, false},
+		{"p224", Config{Curve: elliptic.P224()}, true},
+		{"p256", Config{Curve: elliptic.P256()}, false},
+		{"rsa ignores curve", Config{KeyType: KeyRSA, Curve: elliptic.P224()}, false},
+	} {
+		tc.cfg.Hosts = []string{"key-size.example.test"}
+		err := tc.cfg.Validate()
+		if tc.wantErr && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+		if !tc.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+	}
+}
+
+func TestKeyStrengthLoadedKeys(t *testing.T) {
+	weak, err := Generate(Config{
+		Hosts:      []string{"weak.example.test"},
+		KeyType:    KeyRSA,
+		RSABits:    1024,
+		MinRSABits: 1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := Config{
+		Hosts:               []string{"weak.example.test"},
+		RootCACertPEM:       weak.Root.PublicBytes,
+		RootCAPrivateKeyPEM: weak.Root.PrivateBytes,
+	}
+	if _, err := Generate(root); err == nil || !strings.Contains(err.Error(), "too small") {
+		t.Errorf("expected an error loading a 1024-bit root, got %v", err)
+	}
+	root.MinRSABits = 1024
+	if _, err := Generate(root); err != nil {
+		t.Errorf("expected MinRSABits to allow a 1024-bit root, got %v", err)
+	}
+
+	issuer, err := NewIssuer(weak.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.IssueLeaf(Config{Hosts: []string{"weak.example.test"}}); err == nil {
+		t.Error("expected an error issuing with a 1024-bit issuer key")
+	}
+
+	strong, err := Generate(Config{Hosts: []string{"strong.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = RenewLeaf(weak.Leaf.PrivateBytes, Config{
+		Hosts:               []string{"weak.example.test"},
+		RootCACertPEM:       strong.Root.PublicBytes,
+		RootCAPrivateKeyPEM: strong.Root.PrivateBytes,
+	})
+	if err == nil {
+		t.Error("expected an error renewing a 1024-bit leaf key")
+	}
+
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (Config{}).checkKeyStrength(p224.Public()); err == nil {
+		t.Error("expected an error for a P-224 key")
+	}
+}
+
+// writeRoot writes the root CA in certs to a temporary directory and returns
+// the paths to the certificate and private key.
+func writeRoot(t *testing.T, certs *Certs) (certPath, keyPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	certPath = filepath.Join(dir, "root.pem")
+	keyPath = filepath.Join(dir, "root.key")
+	if err := os.WriteFile(certPath, certs.Root.PublicBytes, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, certs.Root.PrivateBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+func TestLoadRSARoot(t *testing.T) {
+	rsaCerts, err := Generate(Config{
+		Hosts:   []string{"rsa-root.example.test"},
+		KeyType: KeyRSA,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := writeRoot(t, rsaCerts)
+	certs, err := Generate(Config{
+		Hosts:            []string{"rsa-root.example.test"},
+		KeyType:          KeyRSA,
+		RootCACert:       certPath,
+		RootCAPrivateKey: keyPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tls.X509KeyPair(certs.Leaf.PublicBytes, certs.Leaf.PrivateBytes); err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certs.Leaf.PublicBytes)
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.SignatureAlgorithm != x509.SHA256WithRSA {
+		t.Errorf("expected leaf to be signed with SHA256WithRSA, got %s", leaf.SignatureAlgorithm)
+	}
+}
+
+func TestECDSALeafUnderRSARoot(t *testing.T) {
+	rsaCerts, err := Generate(Config{
+		Hosts:   []string{"cross-algorithm.example.test"},
+		KeyType: KeyRSA,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := writeRoot(t, rsaCerts)
+	certs, err := Generate(Config{
+		Hosts:            []string{"cross-algorithm.example.test"},
+		KeyType:          KeyECDSA,
+		RootCACert:       certPath,
+		RootCAPrivateKey: keyPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := certs.Leaf.Certificate
+	if leaf.PublicKeyAlgorithm != x509.ECDSA {
+		t.Errorf("expected an ECDSA leaf key, got %s", leaf.PublicKeyAlgorithm)
+	}
+	if leaf.SignatureAlgorithm != x509.SHA256WithRSA {
+		t.Errorf("expected leaf to be signed with SHA256WithRSA, got %s", leaf.SignatureAlgorithm)
+	}
+	if _, err := tls.X509KeyPair(certs.Leaf.PublicBytes, certs.Leaf.PrivateBytes); err != nil {
+		t.Fatal(err)
+	}
+	if err := certs.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadSEC1Root(t *testing.T) {
+	rootCerts, err := Generate(Config{Hosts: []string{"sec1.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawKey, err := x509.ParsePKCS8PrivateKey(rootCerts.Root.Private.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(rawKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCerts.Root.PrivateBytes = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	certPath, keyPath := writeRoot(t, rootCerts)
+	certs, err := Generate(Config{
+		Hosts:            []string{"sec1.example.test"},
+		RootCACert:       certPath,
+		RootCAPrivateKey: keyPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tls.X509KeyPair(certs.Leaf.PublicBytes, certs.Leaf.PrivateBytes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFullChainPEM(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"chain.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := certs.FullChainPEM()
+	first, rest := pem.Decode(chain)
+	second, rest := pem.Decode(rest)
+	if first == nil || second == nil || len(rest) != 0 {
+		t.Fatalf("expected exactly two PEM blocks in chain, got %q", chain)
+	}
+	if !bytes.Equal(first.Bytes, certs.Leaf.Public.Bytes) {
+		t.Error("expected leaf to be the first certificate in the chain")
+	}
+	if !bytes.Equal(second.Bytes, certs.Root.Public.Bytes) {
+		t.Error("expected root to be the second certificate in the chain")
+	}
+}
+
+func TestClientFullChainPEM(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:        []string{"client-chain.example.test"},
+		Intermediate: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := certs.ClientFullChainPEM()
+	first, rest := pem.Decode(chain)
+	second, rest := pem.Decode(rest)
+	if first == nil || second == nil || len(rest) != 0 {
+		t.Fatalf("expected exactly two PEM blocks in chain, got %q", chain)
+	}
+	if !bytes.Equal(first.Bytes, certs.Client.Public.Bytes) {
+		t.Error("expected client to be the first certificate in the chain")
+	}
+	if !bytes.Equal(second.Bytes, certs.Intermediate.Public.Bytes) {
+		t.Error("expected intermediate to be the second certificate in the chain")
+	}
+}
+
+func TestLoadRootFromMemory(t *testing.T) {
+	rootCerts, err := Generate(Config{Hosts: []string{"memory-root.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := Generate(Config{
+		Hosts:               []string{"memory-root.example.test"},
+		RootCACertPEM:       rootCerts.Root.PublicBytes,
+		RootCAPrivateKeyPEM: rootCerts.Root.PrivateBytes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(certs.Root.PublicBytes, rootCerts.Root.PublicBytes) {
+		t.Error("expected root certificate to be reused")
+	}
+	if _, err := tls.X509KeyPair(certs.Leaf.PublicBytes, certs.Leaf.PrivateBytes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIntermediate(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:        []string{"intermediate.example.test"},
+		Intermediate: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certs.Intermediate == nil {
+		t.Fatal("expected intermediate to be generated")
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certs.Root.PublicBytes)
+	intermediates := x509.NewCertPool()
+	intermediates.AppendCertsFromPEM(certs.Intermediate.PublicBytes)
+	leaf, err := x509.ParseCertificate(certs.Leaf.Public.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       "intermediate.example.test",
+		Roots:         roots,
+		Intermediates: intermediates,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots}); err == nil {
+		t.Error("expected leaf not to verify without the intermediate")
+	}
+	second, _ := pem.Decode(certs.FullChainPEM()[len(certs.Leaf.PublicBytes):])
+	if second == nil || !bytes.Equal(second.Bytes, certs.Intermediate.Public.Bytes) {
+		t.Error("expected intermediate to follow the leaf in the full chain")
+	}
+}
+
+func TestCommonNameNormalized(t *testing.T) {
+	for _, tc := range []struct {
+		hosts []string
+		want  string
+	}{
+		{[]string{"[::1]"}, "::1"},
+		{[]string{" 10.0.0.1 "}, "10.0.0.1"},
+		{[]string{"münchen.example.test"}, "xn--mnchen-3ya.example.test"},
+		{[]string{"admin@example.test", "mail.example.test"}, "mail.example.test"},
+	} {
+		if got := (Config{Hosts: tc.hosts}).Resolved().CommonName; got != tc.want {
+			t.Errorf("%q: got CommonName %q, want %q", tc.hosts, got, tc.want)
+		}
+	}
+}
+
+func TestCommonName(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"first.example.test", "second.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(certs.Leaf.Public.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Subject.CommonName != "first.example.test" {
+		t.Errorf("expected CommonName to default to first host, got %q", leaf.Subject.CommonName)
+	}
+
+	certs, err = Generate(Config{
+		Hosts:      []string{"first.example.test"},
+		CommonName: "My Service",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := x509.ParseCertificate(certs.Client.Public.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Subject.CommonName != "My Service" {
+		t.Errorf("expected CommonName %q, got %q", "My Service", client.Subject.CommonName)
+	}
+}
+
+func TestSubjectFields(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:              []string{"subject.example.test"},
+		Country:            []string{"US"},
+		Province:           []string{"California"},
+		Locality:           []string{"San Francisco"},
+		OrganizationalUnit: []string{"Platform"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*Cert{certs.Root, certs.Leaf, certs.Client} {
+		cert, err := x509.ParseCertificate(c.Public.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subj := cert.Subject
+		if len(subj.Country) != 1 || subj.Country[0] != "US" {
+			t.Errorf("bad Country: %v", subj.Country)
+		}
+		if len(subj.Province) != 1 || subj.Province[0] != "California" {
+			t.Errorf("bad Province: %v", subj.Province)
+		}
+		if len(subj.Locality) != 1 || subj.Locality[0] != "San Francisco" {
+			t.Errorf("bad Locality: %v", subj.Locality)
+		}
+		if len(subj.OrganizationalUnit) != 1 || subj.OrganizationalUnit[0] != "Platform" {
+			t.Errorf("bad OrganizationalUnit: %v", subj.OrganizationalUnit)
+		}
+	}
+}
+
+func TestEmailAddresses(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:          []string{"email.example.test", "ops@example.test"},
+		EmailAddresses: []string{"admin@example.test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(certs.Leaf.Public.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != "email.example.test" {
+		t.Errorf("bad DNSNames: %v", leaf.DNSNames)
+	}
+	if len(leaf.EmailAddresses) != 2 || leaf.EmailAddresses[0] != "admin@example.test" || leaf.EmailAddresses[1] != "ops@example.test" {
+		t.Errorf("bad EmailAddresses: %v", leaf.EmailAddresses)
+	}
+}
+
+func TestURIs(t *testing.T) {
+	certs, err := Generate(Config{URIs: []string{"spiffe://example.test/workload"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(certs.Leaf.Public.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaf.URIs) != 1 || leaf.URIs[0].String() != "spiffe://example.test/workload" {
+		t.Errorf("bad URIs: %v", leaf.URIs)
+	}
+
+	if _, err := Generate(Config{URIs: []string{"spiffe://bad host/%zz"}}); err == nil {
+		t.Error("expected error for invalid URI, got nil")
+	}
+	if _, err := Generate(Config{URIs: []string{"workload"}}); err == nil {
+		t.Error("expected error for relative URI, got nil")
+	}
+}
+
+func TestSerials(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:        []string{"serial.example.test"},
+		LeafSerial:   big.NewInt(1001),
+		ClientSerial: big.NewInt(1002),
+		RootSerial:   big.NewInt(1000),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		cert   *Cert
+		serial int64
+	}{
+		{certs.Root, 1000},
+		{certs.Leaf, 1001},
+		{certs.Client, 1002},
+	} {
+		cert, err := x509.ParseCertificate(tt.cert.Public.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.SerialNumber.Int64() != tt.serial {
+			t.Errorf("expected serial %d, got %s", tt.serial, cert.SerialNumber)
+		}
+		if want := big.NewInt(tt.serial).String(); cert.Subject.SerialNumber != want {
+			t.Errorf("expected subject serial %s, got %s", want, cert.Subject.SerialNumber)
+		}
+	}
+}
+
+// opaqueSigner hides the concrete type of a private key, like a KMS-backed
+// crypto.Signer would.
+type opaqueSigner struct {
+	signer crypto.Signer
+}
+
+func (s opaqueSigner) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+func (s opaqueSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.signer.Sign(rand, digest, opts)
+}
+
+func TestRootSigner(t *testing.T) {
+	rootCerts, err := Generate(Config{Hosts: []string{"root-signer.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(rootCerts.Root.PrivateDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := opaqueSigner{key.(crypto.Signer)}
+	certs, err := Generate(Config{
+		Hosts:           []string{"root-signer.example.test"},
+		RootCertificate: rootCerts.Root.Certificate,
+		RootSigner:      signer,
+		Intermediate:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(certs.Root.PublicDER, rootCerts.Root.PublicDER) {
+		t.Error("expected the root certificate to be reused")
+	}
+	if certs.Root.Private != nil {
+		t.Error("expected no root private key")
+	}
+	if err := certs.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Generate(Config{
+		Hosts:           []string{"root-signer.example.test"},
+		RootCertificate: rootCerts.Root.Certificate,
+	}); err == nil {
+		t.Error("expected an error setting RootCertificate without RootSigner")
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Generate(Config{
+		Hosts:           []string{"root-signer.example.test"},
+		RootCertificate: rootCerts.Root.Certificate,
+		RootSigner:      otherKey,
+	}); err == nil {
+		t.Error("expected an error with a RootSigner that doesn't match RootCertificate")
+	}
+	if _, err := Generate(Config{
+		Hosts:              []string{"root-signer.example.test"},
+		RootCertificate:    rootCerts.Root.Certificate,
+		RootSigner:         signer,
+		SignatureAlgorithm: x509.SHA256WithRSA,
+	}); err == nil {
+		t.Error("expected an error using an RSA signature algorithm with an ECDSA RootSigner")
+	}
+}
+
+func TestNoSubjectSerial(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:           []string{"no-subject-serial.example.test"},
+		Intermediate:    true,
+		NoSubjectSerial: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*Cert{certs.Root, certs.Intermediate, certs.Leaf, certs.Client} {
+		if got := c.Certificate.Subject.SerialNumber; got != "" {
+			t.Errorf("expected no subject serial number, got %q", got)
+		}
+	}
+	if err := certs.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSerialFunc(t *testing.T) {
+	var counter int64 = 100
+	certs, err := Generate(Config{
+		Hosts:        []string{"serial-func.example.test"},
+		Intermediate: true,
+		LeafSerial:   big.NewInt(5),
+		SerialFunc: func() (*big.Int, error) {
+			counter++
+			return big.NewInt(counter), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[int64]bool)
+	for _, c := range []*Cert{certs.Root, certs.Intermediate, certs.Client} {
+		serial := c.Certificate.SerialNumber.Int64()
+		if serial <= 100 || serial > counter || seen[serial] {
+			t.Errorf("expected a distinct serial from SerialFunc, got %d", serial)
+		}
+		seen[serial] = true
+	}
+	if got := certs.Leaf.Certificate.SerialNumber.Int64(); got != 5 {
+		t.Errorf("expected LeafSerial to take precedence over SerialFunc, got %d", got)
+	}
+	if counter != 103 {
+		t.Errorf("expected SerialFunc to be called 3 times, got %d", counter-100)
+	}
+
+	if _, err := Generate(Config{
+		Hosts:      []string{"serial-func.example.test"},
+		SerialFunc: func() (*big.Int, error) { return big.NewInt(0), nil },
+	}); err == nil {
+		t.Error("expected an error when SerialFunc returns zero")
+	}
+	if _, err := Generate(Config{
+		Hosts:      []string{"serial-func.example.test"},
+		SerialFunc: func() (*big.Int, error) { return nil, errors.New("database unavailable") },
+	}); err == nil {
+		t.Error("expected SerialFunc's error to be returned")
+	}
+}
+
+func TestKeyPassword(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:       []string{"encrypted.example.test"},
+		KeyPassword: "hunter2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certs.Leaf.PrivateBytes)
+	if block == nil || block.Type != "ENCRYPTED PRIVATE KEY" {
+		t.Fatalf("expected ENCRYPTED PRIVATE KEY block, got %q", certs.Leaf.PrivateBytes)
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		t.Error("expected encrypted key not to parse as a plain PKCS#8 key")
+	}
+}
+
+func TestRootCAKeyPassword(t *testing.T) {
+	rootCerts, err := Generate(Config{
+		Hosts:       []string{"encrypted-root.example.test"},
+		KeyPassword: "hunter2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{
+		Hosts:               []string{"encrypted-root.example.test"},
+		RootCACertPEM:       rootCerts.Root.PublicBytes,
+		RootCAPrivateKeyPEM: rootCerts.Root.PrivateBytes,
+	}
+	if _, err := Generate(cfg); err == nil {
+		t.Error("expected an error loading an encrypted root key without a password")
+	}
+	cfg.RootCAKeyPassword = "wrong"
+	if _, err := Generate(cfg); err == nil {
+		t.Error("expected an error loading an encrypted root key with the wrong password")
+	}
+	cfg.RootCAKeyPassword = "hunter2"
+	certs, err := Generate(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(certs.Root.PublicBytes, rootCerts.Root.PublicBytes) {
+		t.Error("expected root certificate to be reused")
+	}
+	if err := certs.Leaf.Certificate.CheckSignatureFrom(rootCerts.Root.Certificate); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPKCS12EncryptedKey(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:       []string{"p12.example.test"},
+		KeyPassword: "hunter2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = certs.PKCS12("hunter2")
+	if err == nil || !strings.Contains(err.Error(), "encrypted leaf private key") {
+		t.Errorf("expected a clear error for an encrypted leaf key, got %v", err)
+	}
+}
+
+func TestPKCS12(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:        []string{"p12.example.test"},
+		Intermediate: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p12, err := certs.PKCS12("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, leaf, caCerts, err := pkcs12.DecodeChain(p12, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := key.(*ecdsa.PrivateKey); !ok {
+		t.Errorf("expected *ecdsa.PrivateKey, got %T", key)
+	}
+	if !bytes.Equal(leaf.Raw, certs.Leaf.Public.Bytes) {
+		t.Error("expected leaf certificate to round trip")
+	}
+	if len(caCerts) != 2 {
+		t.Fatalf("expected 2 CA certificates, got %d", len(caCerts))
+	}
+	if !bytes.Equal(caCerts[1].Raw, certs.Root.Public.Bytes) {
+		t.Error("expected root certificate to round trip")
+	}
+}
+
+func TestGenerateContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := GenerateContext(ctx, Config{Hosts: []string{"canceled.example.test"}})
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRootConfigErrors(t *testing.T) {
+	_, err := Generate(Config{RootCACert: "root.pem"})
+	if !errors.Is(err, ErrMissingRootPair) {
+		t.Errorf("expected ErrMissingRootPair, got %v", err)
+	}
+	_, err = Generate(Config{RootCAPrivateKeyPEM: []byte("key")})
+	if !errors.Is(err, ErrMissingRootPair) {
+		t.Errorf("expected ErrMissingRootPair, got %v", err)
+	}
+	_, err = Generate(Config{
+		RootCACert:       "root.pem",
+		RootCAPrivateKey: "root.key",
+		RootValidFor:     time.Hour,
+	})
+	if !errors.Is(err, ErrRootValidFor) {
+		t.Errorf("expected ErrRootValidFor, got %v", err)
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("no entropy") }
+
+func TestRand(t *testing.T) {
+	if _, err := Generate(Config{Hosts: []string{"rand.example.test"}, Rand: errReader{}}); err == nil {
+		t.Error("expected error from failing Rand, got nil")
+	}
+
+	// Ed25519 keys are derived directly from Rand, so a fixed seed should
+	// produce the same keys.
+	var keys [][]byte
+	for i := 0; i < 2; i++ {
+		certs, err := Generate(Config{
+			Hosts:   []string{"rand.example.test"},
+			KeyType: KeyEd25519,
+			Rand:    mathrand.New(mathrand.NewSource(1)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, certs.Leaf.PrivateBytes)
+	}
+	if !bytes.Equal(keys[0], keys[1]) {
+		t.Error("expected the same seed to produce the same leaf key")
+	}
+}
+
+func TestNotBefore(t *testing.T) {
+	notBefore := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	certs, err := Generate(Config{
+		Hosts:        []string{"not-before.example.test"},
+		NotBefore:    notBefore,
+		LeafValidFor: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*Cert{certs.Root, certs.Leaf, certs.Client} {
+		cert, err := x509.ParseCertificate(c.Public.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cert.NotBefore.Equal(notBefore) {
+			t.Errorf("expected NotBefore %v, got %v", notBefore, cert.NotBefore)
+		}
+	}
+	leaf, err := x509.ParseCertificate(certs.Leaf.Public.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := notBefore.Add(24 * time.Hour); !leaf.NotAfter.Equal(want) {
+		t.Errorf("expected NotAfter %v, got %v", want, leaf.NotAfter)
+	}
+}
+
+func TestBackdate(t *testing.T) {
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	certs, err := Generate(Config{
+		Hosts:    []string{"backdate.example.test"},
+		Backdate: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := time.Now().Add(-time.Hour)
+	for _, c := range []*Cert{certs.Root, certs.Leaf, certs.Client} {
+		if c.NotBefore.Before(start) || c.NotBefore.After(end) {
+			t.Errorf("NotBefore: got %v, want about an hour ago", c.NotBefore)
+		}
+		if got := c.NotAfter.Sub(c.NotBefore); got != 365*24*time.Hour {
+			t.Errorf("expected validity to be measured from the backdated NotBefore, got %v", got)
+		}
+	}
+
+	notBefore := time.Now().Add(time.Hour).Truncate(time.Second)
+	certs, err = Generate(Config{
+		Hosts:     []string{"backdate.example.test"},
+		NotBefore: notBefore,
+		Backdate:  time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !certs.Leaf.NotBefore.Equal(notBefore) {
+		t.Errorf("expected an explicit NotBefore not to be backdated, got %v", certs.Leaf.NotBefore)
+	}
+	if _, err := Generate(Config{Hosts: []string{"backdate.example.test"}, Backdate: -time.Minute}); err == nil {
+		t.Error("expected an error with a negative Backdate")
+	}
+}
+
+func TestKeyUsage(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:           []string{"key-usage.example.test"},
+		LeafKeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		LeafExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageEmailProtection},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(certs.Leaf.Public.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.KeyUsage != x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment {
+		t.Errorf("bad leaf KeyUsage: %v", leaf.KeyUsage)
+	}
+	if len(leaf.ExtKeyUsage) != 2 || leaf.ExtKeyUsage[1] != x509.ExtKeyUsageEmailProtection {
+		t.Errorf("bad leaf ExtKeyUsage: %v", leaf.ExtKeyUsage)
+	}
+	client, err := x509.ParseCertificate(certs.Client.Public.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.KeyUsage != x509.KeyUsageDigitalSignature {
+		t.Errorf("expected default client KeyUsage, got %v", client.KeyUsage)
+	}
+	if len(client.ExtKeyUsage) != 1 || client.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+		t.Errorf("expected default client ExtKeyUsage, got %v", client.ExtKeyUsage)
+	}
+}
+
+func TestDualUsage(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:      []string{"mesh.example.test"},
+		DualUsage:  true,
+		SkipClient: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	if got := certs.Leaf.Certificate.ExtKeyUsage; !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtKeyUsage: got %v, want %v", got, want)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(certs.Root.Certificate)
+	if _, err := certs.Leaf.Certificate.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		t.Errorf("expected the leaf to verify for client auth: %v", err)
+	}
+}
+
+func TestMaxPathLen(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"path-len.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(certs.Root.Public.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.MaxPathLen != -1 {
+		t.Errorf("expected no path length constraint by default, got %d", root.MaxPathLen)
+	}
+
+	certs, err = Generate(Config{
+		Hosts:          []string{"path-len.example.test"},
+		MaxPathLenZero: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err = x509.ParseCertificate(certs.Root.Public.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.MaxPathLen != 0 || !root.MaxPathLenZero {
+		t.Errorf("expected MaxPathLen 0, got %d (zero=%t)", root.MaxPathLen, root.MaxPathLenZero)
+	}
+}
+
+func TestNameConstraints(t *testing.T) {
+	for _, tt := range []struct {
+		host  string
+		valid bool
+	}{
+		{"api.internal.example.test", true},
+		{"secret.internal.example.test", false},
+		{"evil.example.test", false},
+	} {
+		certs, err := Generate(Config{
+			Hosts:               []string{tt.host},
+			PermittedDNSDomains: []string{"internal.example.test"},
+			ExcludedDNSDomains:  []string{"secret.internal.example.test"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM(certs.Root.PublicBytes)
+		leaf, err := x509.ParseCertificate(certs.Leaf.Public.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = leaf.Verify(x509.VerifyOptions{DNSName: tt.host, Roots: roots})
+		if tt.valid && err != nil {
+			t.Errorf("%s: expected leaf to verify, got %v", tt.host, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: expected leaf to be rejected by name constraints", tt.host)
+		}
+	}
+}
+
+func TestDER(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"der.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := x509.ParseCertificate(certs.Leaf.PublicDER); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(certs.Leaf.PrivateDER); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"fingerprint.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(certs.Leaf.PublicDER)
+	if certs.Leaf.FingerprintSHA256() != sum {
+		t.Error("bad fingerprint")
+	}
+	hex := certs.Leaf.FingerprintSHA256Hex()
+	if len(hex) != 32*3-1 || hex[:2] != fmt.Sprintf("%02x", sum[0]) || hex[2] != ':' {
+		t.Errorf("bad hex fingerprint %q", hex)
+	}
+}
+
+func TestRevocationURLs(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:                 []string{"revocation.example.test"},
+		OCSPServer:            []string{"http://ocsp.example.test"},
+		CRLDistributionPoints: []string{"http://crl.example.test/root.crl"},
+		IssuingCertificateURL: []string{"http://ca.example.test/root.pem"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*Cert{certs.Leaf, certs.Client} {
+		cert, err := x509.ParseCertificate(c.PublicDER)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cert.OCSPServer) != 1 || cert.OCSPServer[0] != "http://ocsp.example.test" {
+			t.Errorf("bad OCSPServer: %v", cert.OCSPServer)
+		}
+		if len(cert.CRLDistributionPoints) != 1 || cert.CRLDistributionPoints[0] != "http://crl.example.test/root.crl" {
+			t.Errorf("bad CRLDistributionPoints: %v", cert.CRLDistributionPoints)
+		}
+		if len(cert.IssuingCertificateURL) != 1 || cert.IssuingCertificateURL[0] != "http://ca.example.test/root.pem" {
+			t.Errorf("bad IssuingCertificateURL: %v", cert.IssuingCertificateURL)
+		}
+	}
+}
+
+func TestSkipClient(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:      []string{"no-client.example.test"},
+		SkipClient: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certs.Client != nil {
+		t.Error("expected no client cert")
+	}
+	config, err := certs.ClientTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Certificates) != 0 {
+		t.Errorf("expected no client certificates, got %d", len(config.Certificates))
+	}
+}
+
+func TestGenerateMany(t *testing.T) {
+	certs, leaves, err := GenerateMany(Config{Hosts: []string{"main.example.test"}}, []LeafConfig{
+		{Hosts: []string{"one.example.test"}},
+		{Hosts: []string{"two.example.test"}, Org: "Two Co"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaves) != 2 {
+		t.Fatalf("expected 2 leaves, got %d", len(leaves))
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certs.Root.PublicBytes)
+	for i, host := range []string{"one.example.test", "two.example.test"} {
+		leaf, err := x509.ParseCertificate(leaves[i].PublicDER)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("%s: %v", host, err)
+		}
+		if leaf.Subject.CommonName != host {
+			t.Errorf("expected CommonName %q, got %q", host, leaf.Subject.CommonName)
+		}
+	}
+	leaf, err := x509.ParseCertificate(leaves[1].PublicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Subject.Organization[0] != "Two Co" {
+		t.Errorf("expected Organization %q, got %v", "Two Co", leaf.Subject.Organization)
+	}
+}
+
+func TestGenerateManyValidatesLeaves(t *testing.T) {
+	_, _, err := GenerateMany(Config{Hosts: []string{"main.example.test"}}, []LeafConfig{
+		{Hosts: []string{"one.example.test"}},
+		{Hosts: []string{"bad..example.test"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "leaf config 1") {
+		t.Errorf("expected an error for the invalid leaf config, got %v", err)
+	}
+}
+
+func TestInvalidHosts(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{" padded.example.test ", "*.wildcard.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(certs.Leaf.PublicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaf.DNSNames) != 2 || leaf.DNSNames[0] != "padded.example.test" || leaf.DNSNames[1] != "*.wildcard.example.test" {
+		t.Errorf("bad DNSNames: %q", leaf.DNSNames)
+	}
+
+	for _, host := range []string{"", "  ", "-bad.example.test", "bad-.example.test", "bad..example.test", "under_score.example.test", "foo.*.example.test", strings.Repeat("a", 64) + ".example.test"} {
+		_, err := Generate(Config{Hosts: []string{"good.example.test", host}})
+		if err == nil {
+			t.Errorf("expected error for host %q, got nil", host)
+		} else if !strings.Contains(err.Error(), "invalid hosts") {
+			t.Errorf("expected invalid hosts error for %q, got %v", host, err)
+		}
+	}
+}
+
+func TestNoIdentity(t *testing.T) {
+	if _, err := Generate(Config{}); !errors.Is(err, ErrNoIdentity) {
+		t.Errorf("expected ErrNoIdentity with no hosts, got %v", err)
+	}
+	if _, err := Generate(Config{CommonName: "only-cn", EmptySubject: true}); !errors.Is(err, ErrNoIdentity) {
+		t.Errorf("expected ErrNoIdentity with an empty subject and no SANs, got %v", err)
+	}
+	if _, err := Generate(Config{CommonName: "only-cn"}); err != nil {
+		t.Errorf("expected a common name to be enough, got %v", err)
+	}
+	if _, err := Generate(Config{IntermediateOnly: true}); err != nil {
+		t.Errorf("expected no hosts to be needed with IntermediateOnly, got %v", err)
+	}
+}
+
+func TestNoIdentityAllPaths(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"no-identity.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := NewIssuer(certs.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := Config{
+		RootCACertPEM:       certs.Root.PublicBytes,
+		RootCAPrivateKeyPEM: certs.Root.PrivateBytes,
+	}
+	if _, err := issuer.IssueLeaf(Config{}); !errors.Is(err, ErrNoIdentity) {
+		t.Errorf("IssueLeaf: expected ErrNoIdentity, got %v", err)
+	}
+	if _, err := RenewLeaf(certs.Leaf.PrivateBytes, root); !errors.Is(err, ErrNoIdentity) {
+		t.Errorf("RenewLeaf: expected ErrNoIdentity, got %v", err)
+	}
+	if _, err := GenerateCSR(Config{}); !errors.Is(err, ErrNoIdentity) {
+		t.Errorf("GenerateCSR: expected ErrNoIdentity, got %v", err)
+	}
+	_, _, err = GenerateMany(Config{Hosts: []string{"main.example.test"}}, []LeafConfig{{}})
+	if !errors.Is(err, ErrNoIdentity) {
+		t.Errorf("GenerateMany: expected ErrNoIdentity, got %v", err)
+	}
+}
+
+func TestIDNHostsMapped(t *testing.T) {
+	for host, want := range map[string]string{
+		"MÜNCHEN.example.test":  "xn--mnchen-3ya.example.test",
+		"*.Bücher.example.test": "*.xn--bcher-kva.example.test",
+		"ｅｘａｍｐｌｅ.test":          "example.test",
+		"ｍüｎｃｈｅｎ.example.test":  "xn--mnchen-3ya.example.test",
+	} {
+		got, err := toASCII(host)
+		if err != nil {
+			t.Errorf("%s: %v", host, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: got %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestIDNHosts(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"münchen.example.test", "*.bücher.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(certs.Leaf.PublicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"xn--mnchen-3ya.example.test", "*.xn--bcher-kva.example.test"}
+	if len(leaf.DNSNames) != 2 || leaf.DNSNames[0] != want[0] || leaf.DNSNames[1] != want[1] {
+		t.Errorf("expected DNSNames %q, got %q", want, leaf.DNSNames)
+	}
+	if err := leaf.VerifyHostname("xn--mnchen-3ya.example.test"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	for _, intermediate := range []bool{false, true} {
+		certs, err := Generate(Config{
+			Hosts:        []string{"verify.example.test"},
+			Intermediate: intermediate,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := certs.Verify(); err != nil {
+			t.Errorf("intermediate=%t: %v", intermediate, err)
+		}
+	}
+
+	certs, err := Generate(Config{
+		Hosts:           []string{"verify.example.test"},
+		LeafExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := certs.Verify(); err == nil {
+		t.Error("expected leaf without server auth usage to fail verification")
+	}
+}
+
+func TestEmptySubject(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:        []string{"empty-subject.example.test"},
+		EmptySubject: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(certs.Leaf.PublicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaf.Subject.Names) != 0 {
+		t.Errorf("expected empty subject, got %v", leaf.Subject)
+	}
+	if err := certs.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.VerifyHostname("empty-subject.example.test"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHAProxyPEM(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"haproxy.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keyPEM, certPEM []byte
+	var blocks []*pem.Block
+	rest := certs.HAProxyPEM()
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+		if block.Type == "PRIVATE KEY" {
+			keyPEM = append(keyPEM, pem.EncodeToMemory(block)...)
+		} else {
+			certPEM = append(certPEM, pem.EncodeToMemory(block)...)
+		}
+	}
+	if len(blocks) != 3 || blocks[0].Type != "PRIVATE KEY" || !bytes.Equal(blocks[1].Bytes, certs.Leaf.PublicDER) {
+		t.Fatal("expected the private key, then the leaf, then the root")
+	}
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotBeforeNotAfter(t *testing.T) {
+	notBefore := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	certs, err := Generate(Config{
+		Hosts:        []string{"validity.example.test"},
+		NotBefore:    notBefore,
+		LeafValidFor: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !certs.Leaf.NotBefore.Equal(notBefore) {
+		t.Errorf("leaf NotBefore: got %v, want %v", certs.Leaf.NotBefore, notBefore)
+	}
+	if want := notBefore.Add(24 * time.Hour); !certs.Leaf.NotAfter.Equal(want) {
+		t.Errorf("leaf NotAfter: got %v, want %v", certs.Leaf.NotAfter, want)
+	}
+
+	certPath, keyPath := writeRoot(t, certs)
+	loaded, err := Generate(Config{
+		Hosts:            []string{"validity.example.test"},
+		RootCAPrivateKey: keyPath,
+		RootCACert:       certPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Root.NotAfter.Equal(certs.Root.NotAfter) {
+		t.Errorf("loaded root NotAfter: got %v, want %v", loaded.Root.NotAfter, certs.Root.NotAfter)
+	}
+}
+
+func TestIntermediateValidForWithLoadedRoot(t *testing.T) {
+	rootCerts, err := Generate(Config{Hosts: []string{"intermediate.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := writeRoot(t, rootCerts)
+	certs, err := Generate(Config{
+		Hosts:                []string{"intermediate.example.test"},
+		RootCAPrivateKey:     keyPath,
+		RootCACert:           certPath,
+		Intermediate:         true,
+		IntermediateValidFor: 30 * 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := certs.Intermediate.NotAfter.Sub(certs.Intermediate.NotBefore); got != 30*24*time.Hour {
+		t.Errorf("expected intermediate to be valid for 30 days, got %v", got)
+	}
+	if err := certs.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	cfg := Config{Hosts: []string{"bench.example.test"}}
+	b.Run("Concurrent", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := Generate(cfg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Sequential", func(b *testing.B) {
+		// a custom Rand forces the leaf and client to be generated one
+		// after the other
+		cfg := cfg
+		cfg.Rand = struct{ io.Reader }{rand.Reader}
+		for i := 0; i < b.N; i++ {
+			if _, err := Generate(cfg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestAuthorityKeyID(t *testing.T) {
+	for _, intermediate := range []bool{false, true} {
+		certs, err := Generate(Config{
+			Hosts:        []string{"aki.example.test"},
+			Intermediate: intermediate,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		issuerCert := certs.Root
+		if intermediate {
+			issuerCert = certs.Intermediate
+		}
+		issuer, err := x509.ParseCertificate(issuerCert.PublicDER)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(issuer.SubjectKeyId) == 0 {
+			t.Fatal("expected issuer to have a Subject Key Identifier")
+		}
+		for _, c := range []*Cert{certs.Leaf, certs.Client} {
+			cert, err := x509.ParseCertificate(c.PublicDER)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(cert.AuthorityKeyId, issuer.SubjectKeyId) {
+				t.Errorf("intermediate=%t: AuthorityKeyId %x does not match issuer SubjectKeyId %x", intermediate, cert.AuthorityKeyId, issuer.SubjectKeyId)
+			}
+		}
+	}
+}
+
+func TestAuthorityKeyIDLoadedRootWithoutSKI(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// CreateCertificate always adds a Subject Key Identifier to CA certs, so
+	// mimic an older root by leaving the basic constraints out.
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.SubjectKeyId) != 0 {
+		t.Fatal("expected root without a Subject Key Identifier")
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := Generate(Config{
+		Hosts:               []string{"aki.example.test"},
+		RootCACertPEM:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		RootCAPrivateKeyPEM: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(certs.Leaf.PublicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := subjectKeyID(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaf.AuthorityKeyId) == 0 || !bytes.Equal(leaf.AuthorityKeyId, want) {
+		t.Errorf("expected AuthorityKeyId %x, got %x", want, leaf.AuthorityKeyId)
+	}
+}
+
+func TestWritePEM(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"write-pem.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pub, priv bytes.Buffer
+	if err := certs.Leaf.WritePublicPEM(&pub); err != nil {
+		t.Fatal(err)
+	}
+	if err := certs.Leaf.WritePrivatePEM(&priv); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pub.Bytes(), certs.Leaf.PublicBytes) {
+		t.Error("expected WritePublicPEM to match PublicBytes")
+	}
+	if !bytes.Equal(priv.Bytes(), certs.Leaf.PrivateBytes) {
+		t.Error("expected WritePrivatePEM to match PrivateBytes")
+	}
+	if err := (&Cert{}).WritePrivatePEM(&priv); err == nil {
+		t.Error("expected an error writing a cert without a private key")
+	}
+}
+
+func TestBase64(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"base64.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := base64.StdEncoding.DecodeString(certs.Leaf.PublicBase64())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(public, certs.Leaf.PublicDER) {
+		t.Error("expected PublicBase64 to decode to the DER certificate")
+	}
+	private, err := base64.StdEncoding.DecodeString(certs.Leaf.PrivateBase64())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(private, certs.Leaf.PrivateDER) {
+		t.Error("expected PrivateBase64 to decode to the DER private key")
+	}
+}
+
+func TestBytesCRLF(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"crlf.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"public":  certs.Leaf.PublicBytesCRLF(),
+		"private": certs.Leaf.PrivateBytesCRLF(),
+	} {
+		if !bytes.HasSuffix(data, []byte("-----\r\n")) {
+			t.Errorf("%s: expected a trailing \\r\\n, got %q", name, data[len(data)-8:])
+		}
+		if n := bytes.Count(data, []byte("\n")); n != bytes.Count(data, []byte("\r\n")) {
+			t.Errorf("%s: expected every line to end in \\r\\n", name)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			t.Errorf("%s: could not decode CRLF PEM", name)
+		}
+	}
+	if bytes.Contains(certs.Leaf.PublicBytes, []byte("\r")) {
+		t.Error("PublicBytesCRLF should not modify PublicBytes")
+	}
+}
+
+func TestRootOrg(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:        []string{"root-org.example.test"},
+		Org:          "Service Owner",
+		RootOrg:      "Example Root CA",
+		Intermediate: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		cert *Cert
+		want string
+	}{
+		{certs.Root, "Example Root CA"},
+		{certs.Intermediate, "Example Root CA"},
+		{certs.Leaf, "Service Owner"},
+		{certs.Client, "Service Owner"},
+	} {
+		cert, err := x509.ParseCertificate(tc.cert.PublicDER)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cert.Subject.Organization) != 1 || cert.Subject.Organization[0] != tc.want {
+			t.Errorf("expected organization %q, got %v", tc.want, cert.Subject.Organization)
+		}
+	}
+	if err := certs.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRootCommonName(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:          []string{"root-cn.example.test"},
+		RootCommonName: "Example Internal Root CA 2024",
+		Intermediate:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := certs.Root.Certificate.Subject.CommonName; got != "Example Internal Root CA 2024" {
+		t.Errorf("root CommonName: got %q", got)
+	}
+	if got := certs.Intermediate.Certificate.Subject.CommonName; got != "" {
+		t.Errorf("expected no intermediate CommonName, got %q", got)
+	}
+	if got := certs.Leaf.Certificate.Subject.CommonName; got != "root-cn.example.test" {
+		t.Errorf("leaf CommonName: got %q", got)
+	}
+	if err := certs.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRootNoEKU(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:        []string{"root-no-eku.example.test"},
+		RootNoEKU:    true,
+		Intermediate: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range certs.Root.Certificate.Extensions {
+		if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 37}) {
+			t.Error("expected no Extended Key Usage extension on the root")
+		}
+	}
+	if len(certs.Leaf.Certificate.ExtKeyUsage) == 0 {
+		t.Error("expected the leaf to keep its Extended Key Usage")
+	}
+	if err := certs.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCTPoison(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:    []string{"precert.example.test"},
+		CTPoison: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(certs.Leaf.PublicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, ext := range leaf.Extensions {
+		if ext.Id.Equal(oidCTPoison) {
+			found = true
+			if !ext.Critical {
+				t.Error("expected poison extension to be critical")
+			}
+			if !bytes.Equal(ext.Value, []byte{0x05, 0x00}) {
+				t.Errorf("expected poison extension value to be ASN.1 NULL, got %x", ext.Value)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("expected leaf to have the CT poison extension")
+	}
+	client, err := x509.ParseCertificate(certs.Client.PublicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range client.Extensions {
+		if ext.Id.Equal(oidCTPoison) {
+			t.Error("expected client cert not to have the CT poison extension")
+		}
+	}
+}
+
+func TestBasicConstraintsCritical(t *testing.T) {
+	basicConstraints := func(t *testing.T, c *Cert) pkix.Extension {
+		t.Helper()
+		for _, ext := range c.Certificate.Extensions {
+			if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 19}) {
+				return ext
+			}
+		}
+		t.Fatal("no Basic Constraints extension")
+		return pkix.Extension{}
+	}
+	certs, err := Generate(Config{Hosts: []string{"basic-constraints.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !basicConstraints(t, certs.Leaf).Critical {
+		t.Error("expected Basic Constraints to be critical by default")
+	}
+
+	critical := false
+	certs, err = Generate(Config{
+		Hosts:                    []string{"basic-constraints.example.test"},
+		Intermediate:             true,
+		BasicConstraintsCritical: &critical,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*Cert{certs.Leaf, certs.Client} {
+		if basicConstraints(t, c).Critical {
+			t.Errorf("%s: expected Basic Constraints not to be critical", c.Certificate.Subject)
+		}
+	}
+	for _, c := range []*Cert{certs.Root, certs.Intermediate} {
+		if !basicConstraints(t, c).Critical {
+			t.Errorf("%s: expected Basic Constraints to stay critical on CA certs", c.Certificate.Subject)
+		}
+	}
+	if !certs.Intermediate.Certificate.IsCA || !certs.Intermediate.Certificate.MaxPathLenZero {
+		t.Error("expected the intermediate to keep its CA and path length constraints")
+	}
+	if certs.Leaf.Certificate.IsCA {
+		t.Error("expected the leaf not to be a CA")
+	}
+	if err := certs.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMustStaple(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:      []string{"must-staple.example.test"},
+		MustStaple: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, ext := range certs.Leaf.Certificate.Extensions {
+		if !ext.Id.Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}) {
+			continue
+		}
+		found = true
+		if ext.Critical {
+			t.Error("expected the TLS Feature extension not to be critical")
+		}
+		var features []int
+		if rest, err := asn1.Unmarshal(ext.Value, &features); err != nil || len(rest) != 0 {
+			t.Fatalf("could not decode TLS Feature extension %x: %v", ext.Value, err)
+		}
+		if len(features) != 1 || features[0] != 5 {
+			t.Errorf("expected the status_request (5) feature, got %v", features)
+		}
+	}
+	if !found {
+		t.Fatal("expected leaf to have the TLS Feature extension")
+	}
+	for _, ext := range certs.Client.Certificate.Extensions {
+		if ext.Id.Equal(oidTLSFeature) {
+			t.Error("expected client cert not to be Must-Staple")
+		}
+	}
+}
+
+func TestExtraExtensions(t *testing.T) {
+	leafExt := pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 1}, Value: []byte{0x05, 0x00}}
+	clientExt := pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 2}, Value: []byte{0x05, 0x00}}
+	certs, err := Generate(Config{
+		Hosts:                 []string{"extensions.example.test"},
+		ExtraLeafExtensions:   []pkix.Extension{leafExt},
+		ExtraClientExtensions: []pkix.Extension{clientExt},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasExtension := func(c *Cert, id asn1.ObjectIdentifier) bool {
+		t.Helper()
+		cert, err := x509.ParseCertificate(c.PublicDER)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(id) {
+				return true
+			}
+		}
+		return false
+	}
+	if !hasExtension(certs.Leaf, leafExt.Id) || hasExtension(certs.Leaf, clientExt.Id) {
+		t.Error("expected leaf to have only the leaf extension")
+	}
+	if !hasExtension(certs.Client, clientExt.Id) || hasExtension(certs.Client, leafExt.Id) {
+		t.Error("expected client to have only the client extension")
+	}
+	if err := certs.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPolicyOIDs(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:      []string{"policy.example.test"},
+		PolicyOIDs: []string{"2.23.140.1.2.1", "1.3.6.1.4.1.55555.1.2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*Cert{certs.Leaf, certs.Client} {
+		cert, err := x509.ParseCertificate(c.PublicDER)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cert.Policies) != 2 || cert.Policies[0].String() != "2.23.140.1.2.1" || cert.Policies[1].String() != "1.3.6.1.4.1.55555.1.2" {
+			t.Errorf("unexpected policies: %v", cert.Policies)
+		}
+	}
+
+	for _, oid := range []string{"", "not-an-oid", "1", "1.2.", "1..2"} {
+		_, err := Generate(Config{
+			Hosts:      []string{"policy.example.test"},
+			PolicyOIDs: []string{oid},
+		})
+		if err == nil || !strings.Contains(err.Error(), "invalid policy OID") {
+			t.Errorf("%q: expected invalid policy OID error, got %v", oid, err)
+		}
+	}
+}
+
+func TestLeafIsCA(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:    []string{"sub-ca.example.test"},
+		LeafIsCA: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(certs.Leaf.PublicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !leaf.IsCA || leaf.KeyUsage&x509.KeyUsageCertSign == 0 {
+		t.Fatal("expected leaf to be a CA with the cert sign key usage")
+	}
+
+	// the leaf should be able to sign certs of its own
+	nested, err := Generate(Config{
+		Hosts:               []string{"nested.example.test"},
+		RootCACertPEM:       certs.Leaf.PublicBytes,
+		RootCAPrivateKeyPEM: certs.Leaf.PrivateBytes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nestedLeaf, err := x509.ParseCertificate(nested.Leaf.PublicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certs.Root.PublicBytes)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(leaf)
+	if _, err := nestedLeaf.Verify(x509.VerifyOptions{
+		DNSName:       "nested.example.test",
+		Roots:         roots,
+		Intermediates: intermediates,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the intermediate has a path length of zero, so can't issue a CA
+	_, err = Generate(Config{
+		Hosts:        []string{"sub-ca.example.test"},
+		LeafIsCA:     true,
+		Intermediate: true,
+	})
+	if err == nil {
+		t.Fatal("expected an error issuing a CA leaf under an intermediate")
+	}
+}
+
+func TestIPHosts(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"10.0.0.1", "::1", "[2001:db8::1]"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(certs.Leaf.PublicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaf.DNSNames) != 0 {
+		t.Errorf("expected no DNS names, got %q", leaf.DNSNames)
+	}
+	if len(leaf.IPAddresses) != 3 || leaf.IPAddresses[2].String() != "2001:db8::1" {
+		t.Errorf("bad IPAddresses: %v", leaf.IPAddresses)
+	}
+
+	for _, host := range []string{"10.0.0.0/24", "2001:db8::/64"} {
+		_, err := Generate(Config{Hosts: []string{host}})
+		if err == nil || !strings.Contains(err.Error(), "CIDR range") {
+			t.Errorf("expected CIDR error for %q, got %v", host, err)
+		}
+	}
+}
+
+func TestIPAsDNS(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:   []string{"ipasdns.example.test", "192.0.2.1", "[2001:db8::1]"},
+		IPAsDNS: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ipasdns.example.test", "192.0.2.1", "2001:db8::1"}
+	if got := certs.Leaf.Certificate.DNSNames; !reflect.DeepEqual(got, want) {
+		t.Errorf("DNSNames: got %q, want %q", got, want)
+	}
+	if got := certs.Leaf.Certificate.IPAddresses; len(got) != 2 {
+		t.Errorf("expected IPs to stay in the IP SANs, got %v", got)
+	}
+}
+
+func TestGenCertMixedKeyTypes(t *testing.T) {
+	keyTypes := []KeyType{KeyECDSA, KeyRSA, KeyEd25519}
+	for _, caType := range keyTypes {
+		for _, leafType := range keyTypes {
+			t.Run(caType.String()+"/"+leafType.String(), func(t *testing.T) {
+				caCfg := Config{KeyType: caType, RSABits: 2048}.withDefaults()
+				caTemplate := &x509.Certificate{
+					SerialNumber:          big.NewInt(1),
+					Subject:               pkix.Name{CommonName: "mixed root"},
+					NotBefore:             time.Now(),
+					NotAfter:              time.Now().Add(time.Hour),
+					IsCA:                  true,
+					KeyUsage:              x509.KeyUsageCertSign,
+					BasicConstraintsValid: true,
+				}
+				ca, caKey, err := genCert(caCfg, caTemplate, caTemplate, nil, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				leafCfg := Config{KeyType: leafType, RSABits: 2048}.withDefaults()
+				leafKey, err := generateKey(leafCfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				leafTemplate := &x509.Certificate{
+					SerialNumber: big.NewInt(2),
+					DNSNames:     []string{"mixed.example.test"},
+					NotBefore:    time.Now(),
+					NotAfter:     time.Now().Add(time.Hour),
+				}
+				leaf, _, err := genCert(leafCfg, leafTemplate, caTemplate, caKey, leafKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := leaf.Certificate.CheckSignatureFrom(ca.Certificate); err != nil {
+					t.Fatal(err)
+				}
+				if got := leaf.Certificate.PublicKeyAlgorithm.String(); !strings.EqualFold(got, leafType.String()) {
+					t.Errorf("leaf public key algorithm: got %s, want %s", got, leafType)
+				}
+			})
+		}
+	}
+}
+
+func TestCertificateField(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"parsed.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*Cert{certs.Root, certs.Leaf, certs.Client} {
+		if c.Certificate == nil || !bytes.Equal(c.Certificate.Raw, c.PublicDER) {
+			t.Fatal("expected Certificate to be the parsed PublicDER")
+		}
+	}
+	if certs.Leaf.Certificate.DNSNames[0] != "parsed.example.test" {
+		t.Errorf("bad DNSNames: %q", certs.Leaf.Certificate.DNSNames)
+	}
+
+	certPath, keyPath := writeRoot(t, certs)
+	loaded, err := Generate(Config{
+		Hosts:            []string{"parsed.example.test"},
+		RootCAPrivateKey: keyPath,
+		RootCACert:       certPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Root.Certificate == nil || !bytes.Equal(loaded.Root.Certificate.Raw, certs.Root.PublicDER) {
+		t.Fatal("expected loaded root Certificate to be the parsed root cert")
+	}
+}
+
+func TestIntermediateOnly(t *testing.T) {
+	rootCerts, err := Generate(Config{Hosts: []string{"offline-root.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := writeRoot(t, rootCerts)
+	certs, err := Generate(Config{
+		RootCAPrivateKey: keyPath,
+		RootCACert:       certPath,
+		IntermediateOnly: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certs.Leaf != nil || certs.Client != nil {
+		t.Fatal("expected no leaf or client certs")
+	}
+	if certs.Intermediate == nil {
+		t.Fatal("expected an intermediate cert")
+	}
+	if certs.FullChainPEM() != nil || certs.ClientFullChainPEM() != nil || certs.HAProxyPEM() != nil {
+		t.Error("expected no leaf or client chains without a leaf cert")
+	}
+	if _, err := certs.ServerTLSConfig(); !errors.Is(err, ErrNoLeaf) {
+		t.Errorf("ServerTLSConfig: expected ErrNoLeaf, got %v", err)
+	}
+	if _, err := certs.PKCS12("hunter2"); !errors.Is(err, ErrNoLeaf) {
+		t.Errorf("PKCS12: expected ErrNoLeaf, got %v", err)
+	}
+	intermediate := certs.Intermediate.Certificate
+	if !intermediate.IsCA || intermediate.KeyUsage&x509.KeyUsageCertSign == 0 {
+		t.Error("expected intermediate to be a CA with the cert sign key usage")
+	}
+	if err := intermediate.CheckSignatureFrom(rootCerts.Root.Certificate); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublicKeyPEM(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"spki.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM, err := certs.Leaf.PublicKeyPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(pubPEM)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		t.Fatal("expected a PUBLIC KEY PEM block")
+	}
+	if !bytes.Equal(block.Bytes, certs.Leaf.Certificate.RawSubjectPublicKeyInfo) {
+		t.Error("expected PublicKeyPEM to contain the cert's SPKI")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	if want := base64.StdEncoding.EncodeToString(sum[:]); certs.Leaf.SPKIPinSHA256() != want {
+		t.Errorf("SPKIPinSHA256: got %q, want %q", certs.Leaf.SPKIPinSHA256(), want)
+	}
+}
+
+func TestResolved(t *testing.T) {
+	cfg := Config{
+		Hosts:    []string{" resolved.example.test ", "10.0.0.1"},
+		Orgs:     []string{"Example Co"},
+		Org:      "Example Team",
+		Backdate: time.Minute,
+	}.Resolved()
+	if cfg.CommonName != "resolved.example.test" {
+		t.Errorf("CommonName: got %q", cfg.CommonName)
+	}
+	if len(cfg.Orgs) != 2 || cfg.Orgs[0] != "Example Co" || cfg.Orgs[1] != "Example Team" || cfg.Org != "" {
+		t.Errorf("expected Org folded into Orgs, got Orgs %q and Org %q", cfg.Orgs, cfg.Org)
+	}
+	if cfg.LeafValidFor != 365*24*time.Hour || cfg.RootValidFor != 365*24*time.Hour || cfg.IntermediateValidFor != cfg.RootValidFor {
+		t.Errorf("unexpected validity periods %v, %v, %v", cfg.LeafValidFor, cfg.RootValidFor, cfg.IntermediateValidFor)
+	}
+	if d := time.Until(cfg.NotBefore); d > -time.Minute+5*time.Second || d < -time.Minute-5*time.Second {
+		t.Errorf("expected NotBefore to be backdated a minute, got %v", cfg.NotBefore)
+	}
+	if cfg.Curve != elliptic.P256() || cfg.RSABits != 2048 {
+		t.Errorf("unexpected key defaults %v, %d", cfg.Curve.Params().Name, cfg.RSABits)
+	}
+	certs, err := Generate(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := certs.Leaf.Certificate.Subject.Organization; len(got) != 2 {
+		t.Errorf("expected a resolved config to generate the same subject, got %q", got)
+	}
+
+	loaded := Config{
+		Hosts:               []string{"resolved.example.test"},
+		RootCACertPEM:       certs.Root.PublicBytes,
+		RootCAPrivateKeyPEM: certs.Root.PrivateBytes,
+	}.Resolved()
+	if loaded.RootValidFor != 0 {
+		t.Errorf("expected no RootValidFor when loading a root, got %v", loaded.RootValidFor)
+	}
+	if _, err := Generate(loaded); err != nil {
+		t.Errorf("expected a resolved config with a loaded root to generate, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Config{Hosts: []string{"validate.example.test"}}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{RootCACert: "root.pem"}, ErrMissingRootPair.Error()},
+		{Config{RootCACert: "root.pem", RootCAPrivateKey: "root.key", RootValidFor: time.Hour}, ErrRootValidFor.Error()},
+		{Config{KeyType: KeyType(42)}, "unknown key type"},
+		{Config{PolicyOIDs: []string{"nope"}}, "invalid policy OID"},
+		{Config{Hosts: []string{"bad..example.test"}}, "invalid hosts"},
+		{Config{URIs: []string{"relative/path"}}, "must be absolute"},
+	} {
+		err := tc.cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: expected error containing %q, got %v", tc.cfg, tc.want, err)
+		}
+	}
+}
+
+func TestOrgs(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts: []string{"orgs.example.test"},
+		Orgs:  []string{"Example Co", "Example Subsidiary"},
+		Org:   "Example Legacy",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the values share a single RDN, which DER sorts, so compare them in
+	// sorted order
+	want := []string{"Example Co", "Example Legacy", "Example Subsidiary"}
+	for _, c := range []*Cert{certs.Root, certs.Leaf, certs.Client} {
+		got := append([]string(nil), c.Certificate.Subject.Organization...)
+		sort.Strings(got)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("expected organizations %q, got %q", want, got)
+		}
+	}
+}
+
+func TestLeafNotAfter(t *testing.T) {
+	notAfter := time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)
+	certs, err := Generate(Config{
+		Hosts:        []string{"not-after.example.test"},
+		LeafNotAfter: notAfter,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*Cert{certs.Leaf, certs.Client} {
+		if !c.NotAfter.Equal(notAfter) {
+			t.Errorf("expected NotAfter %v, got %v", notAfter, c.NotAfter)
+		}
+	}
+
+	_, err = Generate(Config{
+		Hosts:        []string{"not-after.example.test"},
+		LeafNotAfter: notAfter,
+		LeafValidFor: time.Hour,
+	})
+	if err == nil {
+		t.Error("expected an error setting both LeafNotAfter and LeafValidFor")
+	}
+	_, err = Generate(Config{
+		Hosts:        []string{"not-after.example.test"},
+		NotBefore:    notAfter,
+		LeafNotAfter: notAfter.Add(-time.Hour),
+	})
+	if err == nil {
+		t.Error("expected an error with LeafNotAfter before NotBefore")
+	}
+}
+
+func TestClientValidFor(t *testing.T) {
+	notBefore := time.Now().Truncate(time.Second)
+	certs, err := Generate(Config{
+		Hosts:          []string{"client-valid-for.example.test"},
+		NotBefore:      notBefore,
+		LeafValidFor:   30 * 24 * time.Hour,
+		ClientValidFor: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := notBefore.Add(30 * 24 * time.Hour); !certs.Leaf.NotAfter.Equal(want) {
+		t.Errorf("leaf NotAfter: got %v, want %v", certs.Leaf.NotAfter, want)
+	}
+	if want := notBefore.Add(24 * time.Hour); !certs.Client.NotAfter.Equal(want) {
+		t.Errorf("client NotAfter: got %v, want %v", certs.Client.NotAfter, want)
+	}
+}
+
+func TestCheckLeafValidity(t *testing.T) {
+	if err := (Config{}).CheckLeafValidity(); err != nil {
+		t.Errorf("expected the default validity to be accepted, got %v", err)
+	}
+	long := Config{Hosts: []string{"long.example.test"}, LeafValidFor: 2 * 365 * 24 * time.Hour}
+	if err := long.CheckLeafValidity(); !errors.Is(err, ErrLeafValidForTooLong) {
+		t.Errorf("expected ErrLeafValidForTooLong, got %v", err)
+	}
+	notBefore := time.Now()
+	notAfter := Config{NotBefore: notBefore, LeafNotAfter: notBefore.Add(MaxLeafValidFor + time.Hour)}
+	if err := notAfter.CheckLeafValidity(); !errors.Is(err, ErrLeafValidForTooLong) {
+		t.Errorf("expected ErrLeafValidForTooLong with LeafNotAfter, got %v", err)
+	}
+	if _, err := Generate(long); err != nil {
+		t.Errorf("expected long validity to be allowed without StrictValidity, got %v", err)
+	}
+	long.StrictValidity = true
+	if _, err := Generate(long); !errors.Is(err, ErrLeafValidForTooLong) {
+		t.Errorf("expected ErrLeafValidForTooLong with StrictValidity, got %v", err)
+	}
+}
+
+func TestLegacyKeyFormat(t *testing.T) {
+	for _, tc := range []struct {
+		keyType KeyType
+		want    string
+	}{
+		{KeyECDSA, "EC PRIVATE KEY"},
+		{KeyRSA, "RSA PRIVATE KEY"},
+		{KeyEd25519, "PRIVATE KEY"},
+	} {
+		certs, err := Generate(Config{
+			Hosts:           []string{"legacy.example.test"},
+			KeyType:         tc.keyType,
+			LegacyKeyFormat: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if certs.Leaf.Private.Type != tc.want {
+			t.Errorf("key type %d: expected %q block, got %q", tc.keyType, tc.want, certs.Leaf.Private.Type)
+		}
+		if _, err := tls.X509KeyPair(certs.Leaf.PublicBytes, certs.Leaf.PrivateBytes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := Generate(Config{
+		Hosts:           []string{"legacy.example.test"},
+		LegacyKeyFormat: true,
+		KeyPassword:     "hunter2",
+	})
+	if err == nil {
+		t.Error("expected an error setting both LegacyKeyFormat and KeyPassword")
+	}
+}
+
+func TestSignatureAlgorithm(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:              []string{"sigalg.example.test"},
+		SignatureAlgorithm: x509.ECDSAWithSHA384,
+		Intermediate:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*Cert{certs.Root, certs.Intermediate, certs.Leaf, certs.Client} {
+		if c.Certificate.SignatureAlgorithm != x509.ECDSAWithSHA384 {
+			t.Errorf("expected ECDSAWithSHA384, got %v", c.Certificate.SignatureAlgorithm)
+		}
+	}
+	if err := certs.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Generate(Config{
+		Hosts:              []string{"sigalg.example.test"},
+		SignatureAlgorithm: x509.SHA256WithRSA,
+	})
+	if err == nil || !strings.Contains(err.Error(), "cannot be used with ecdsa keys") {
+		t.Errorf("expected incompatible signature algorithm error, got %v", err)
+	}
+
+	// an ECDSA root can't sign with an RSA algorithm, even if the leaf is RSA
+	_, err = Generate(Config{
+		Hosts:               []string{"sigalg.example.test"},
+		KeyType:             KeyRSA,
+		SignatureAlgorithm:  x509.SHA256WithRSA,
+		RootCACertPEM:       certs.Root.PublicBytes,
+		RootCAPrivateKeyPEM: certs.Root.PrivateBytes,
+	})
+	if err == nil || !strings.Contains(err.Error(), "issuer's ecdsa key") {
+		t.Errorf("expected incompatible root key error, got %v", err)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	_, err := Generate(Config{
+		Hosts:        []string{"logger.example.test"},
+		Intermediate: true,
+		Logger:       logger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"generated root CA", "generated intermediate CA", "signed leaf cert", "signed client cert"} {
+		if !strings.Contains(buf.String(), msg) {
+			t.Errorf("expected log output to contain %q, got:\n%s", msg, buf.String())
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Package certtest generates ephemeral certs for tests that need TLS, such as
+// httptest servers with client certs.
+package certtest
+
+import (
+	"crypto/tls"
+	"testing"
+
+	gencert "github.com/meterup/generate-cert/lib"
+)
+
+// ServerAndClient generates a root CA, leaf and client cert for hosts, and
+// returns TLS configs for a server presenting the leaf cert and a client
+// presenting the client cert. Each trusts the root CA to verify the other,
+// and the server requires a client cert. If hosts is empty the certs are
+// issued for "127.0.0.1", "::1" and "localhost", which covers httptest
+// servers. The test fails immediately if the certs can't be generated.
+func ServerAndClient(t testing.TB, hosts ...string) (server, client *tls.Config) {
+	t.Helper()
+	if len(hosts) == 0 {
+		hosts = []string{"127.0.0.1", "::1", "localhost"}
+	}
+	certs, err := gencert.Generate(gencert.Config{Hosts: hosts})
+	if err != nil {
+		t.Fatalf("certtest: generating certs: %v", err)
+	}
+	server, err = certs.ServerTLSConfig()
+	if err != nil {
+		t.Fatalf("certtest: building server TLS config: %v", err)
+	}
+	server.ClientAuth = tls.RequireAndVerifyClientCert
+	client, err = certs.ClientTLSConfig()
+	if err != nil {
+		t.Fatalf("certtest: building client TLS config: %v", err)
+	}
+	return server, client
+}
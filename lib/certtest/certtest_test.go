@@ -0,0 +1,33 @@
+package certtest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerAndClient(t *testing.T) {
+	serverConfig, clientConfig := ServerAndClient(t)
+
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	s.TLS = serverConfig
+	s.StartTLS()
+	defer s.Close()
+
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+	resp, err := c.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "127.0.0.1" {
+		t.Errorf("expected the client cert's CommonName, got %q", body)
+	}
+}
@@ -0,0 +1,80 @@
+package gencert
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+var (
+	crlNumberMu   sync.Mutex
+	lastCRLNumber int64
+)
+
+// nextCRLNumber returns the current time in nanoseconds, or one more than the
+// last number it returned if that's larger, so that CRLs created in quick
+// succession still get strictly increasing numbers.
+func nextCRLNumber() *big.Int {
+	crlNumberMu.Lock()
+	defer crlNumberMu.Unlock()
+	n := time.Now().UnixNano()
+	if n <= lastCRLNumber {
+		n = lastCRLNumber + 1
+	}
+	lastCRLNumber = n
+	return big.NewInt(n)
+}
+
+// CreateCRL returns a PEM encoded certificate revocation list, signed by root,
+// listing the revoked certs. root must include its private key, e.g. as
+// generated by Generate or loaded from disk, and the key must not be
+// encrypted.
+//
+// RFC 5280 requires each CRL from a CA to have a larger CRL number than the
+// last, so callers that keep state should pass the previous number plus one.
+// If number is nil, a number derived from the current time is used, which
+// only increases across calls within this process, or across processes
+// whose clocks don't go backwards.
+func CreateCRL(root *Cert, revoked []pkix.RevokedCertificate, number *big.Int, nextUpdate time.Time) ([]byte, error) {
+	if number == nil {
+		number = nextCRLNumber()
+	} else if number.Sign() < 0 {
+		return nil, errors.New("gencert: CRL number cannot be negative")
+	}
+	if root.Private == nil {
+		return nil, errors.New("gencert: root has no private key to sign the CRL with")
+	}
+	key, err := parsePrivateKey(root.Private)
+	if err != nil {
+		return nil, fmt.Errorf("gencert: could not parse root private key: %v", err)
+	}
+	issuer, err := x509.ParseCertificate(root.Public.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	entries := make([]x509.RevocationListEntry, len(revoked))
+	for i, r := range revoked {
+		entries[i] = x509.RevocationListEntry{
+			SerialNumber:   r.SerialNumber,
+			RevocationTime: r.RevocationTime,
+			Extensions:     r.Extensions,
+		}
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		Number:                    number,
+		ThisUpdate:                now,
+		NextUpdate:                nextUpdate,
+	}, issuer, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CRL: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), nil
+}
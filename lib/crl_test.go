@@ -0,0 +1,80 @@
+package gencert
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestCreateCRL(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"crl.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(certs.Leaf.PublicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlPEM, err := CreateCRL(certs.Root, []pkix.RevokedCertificate{
+		{SerialNumber: leaf.SerialNumber, RevocationTime: time.Now()},
+	}, nil, time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(crlPEM)
+	if block == nil || block.Type != "X509 CRL" {
+		t.Fatalf("expected X509 CRL block, got %q", crlPEM)
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(certs.Root.PublicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.CheckSignatureFrom(root); err != nil {
+		t.Fatal(err)
+	}
+	if len(crl.RevokedCertificateEntries) != 1 || crl.RevokedCertificateEntries[0].SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+		t.Errorf("expected leaf to be revoked, got %v", crl.RevokedCertificateEntries)
+	}
+}
+
+func TestCreateCRLNumber(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"crl.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	number := func(crlPEM []byte) *big.Int {
+		t.Helper()
+		block, _ := pem.Decode(crlPEM)
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return crl.Number
+	}
+	var last *big.Int
+	for i := 0; i < 3; i++ {
+		crlPEM, err := CreateCRL(certs.Root, nil, nil, time.Now().Add(24*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := number(crlPEM)
+		if last != nil && n.Cmp(last) <= 0 {
+			t.Errorf("expected CRL numbers to increase, got %v after %v", n, last)
+		}
+		last = n
+	}
+	crlPEM, err := CreateCRL(certs.Root, nil, big.NewInt(42), time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := number(crlPEM); n.Int64() != 42 {
+		t.Errorf("expected CRL number 42, got %v", n)
+	}
+}
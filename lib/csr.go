@@ -0,0 +1,111 @@
+package gencert
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// SignCSR issues a leaf cert for the PEM encoded certificate signing request
+// in csrPEM, signed by the root CA configured in cfg. The subject, SANs and
+// public key are taken from the CSR; everything else, like the validity
+// period, serial number, key usage and extensions, is taken from cfg as it
+// would be for the leaf cert in Generate. The returned Cert has no private
+// key, since only the requester has it.
+func SignCSR(csrPEM []byte, cfg Config) (*Cert, error) {
+	if err := cfg.checkSettings(); err != nil {
+		return nil, err
+	}
+	if !cfg.loadsRoot() {
+		return nil, errors.New("gencert: must set a root CA to sign the CSR with")
+	}
+	cfg = cfg.withDefaults()
+
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("gencert: could not decode CSR as a PEM encoded CERTIFICATE REQUEST")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("gencert: invalid CSR signature: %v", err)
+	}
+	if err := cfg.checkKeyStrength(csr.PublicKey); err != nil {
+		return nil, err
+	}
+
+	_, rootTemplate, key, err := loadRoot(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.checkLeafIsCA(rootTemplate); err != nil {
+		return nil, err
+	}
+	// the names come from the CSR, so don't build them from cfg
+	cfg.Hosts, cfg.EmailAddresses, cfg.URIs = nil, nil, nil
+	template, err := cfg.leafTemplate()
+	if err != nil {
+		return nil, err
+	}
+	template.Subject = csr.Subject
+	template.DNSNames = csr.DNSNames
+	template.IPAddresses = csr.IPAddresses
+	template.EmailAddresses = csr.EmailAddresses
+	template.URIs = csr.URIs
+	return signCert(cfg, template, rootTemplate, csr.PublicKey, key)
+}
+
+// A CSR is a certificate signing request and its private key, as generated
+// by GenerateCSR.
+type CSR struct {
+	// The certificate signing request, PEM encoded and as raw DER, for CAs
+	// that only accept one or the other.
+	PEM []byte
+	DER []byte
+	// The private key, encoded as it would be for Generate.
+	KeyPEM []byte
+}
+
+// GenerateCSR generates a new private key and a certificate signing request
+// for it, to send to an external CA. The CSR's subject and SANs are built from
+// cfg the same way as the leaf cert in Generate.
+func GenerateCSR(cfg Config) (*CSR, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg = cfg.withDefaults()
+	names, err := cfg.sans()
+	if err != nil {
+		return nil, err
+	}
+	key, err := generateKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.checkKeyStrength(key.Public()); err != nil {
+		return nil, err
+	}
+	template := &x509.CertificateRequest{
+		Subject:        cfg.subject(cfg.CommonName, nil),
+		DNSNames:       names.dnsNames,
+		IPAddresses:    names.ipAddresses,
+		EmailAddresses: names.emailAddresses,
+		URIs:           names.uris,
+	}
+	der, err := x509.CreateCertificateRequest(cfg.Rand, template, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate request: %s", err)
+	}
+	keyBlock, err := encodePrivateKey(cfg, key)
+	if err != nil {
+		return nil, err
+	}
+	return &CSR{
+		PEM:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+		DER:    der,
+		KeyPEM: pem.EncodeToMemory(keyBlock),
+	}, nil
+}
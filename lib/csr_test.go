@@ -0,0 +1,190 @@
+package gencert
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func TestSignCSR(t *testing.T) {
+	rootCerts, err := Generate(Config{Hosts: []string{"csr.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "csr.example.test"},
+		DNSNames: []string{"csr.example.test"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+
+	cert, err := SignCSR(csrPEM, Config{
+		RootCACertPEM:       rootCerts.Root.PublicBytes,
+		RootCAPrivateKeyPEM: rootCerts.Root.PrivateBytes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Private != nil {
+		t.Error("expected signed CSR to have no private key")
+	}
+	leaf, err := x509.ParseCertificate(cert.Public.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.PublicKey.Equal(leaf.PublicKey) {
+		t.Error("expected cert to be issued for the CSR's public key")
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(rootCerts.Root.PublicBytes)
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: "csr.example.test", Roots: roots}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SignCSR(csrPEM, Config{}); err == nil {
+		t.Error("expected error signing CSR without a root CA, got nil")
+	}
+}
+
+func TestGenerateCSR(t *testing.T) {
+	req, err := GenerateCSR(Config{
+		Hosts: []string{"gen-csr.example.test", "10.0.0.1"},
+		Org:   "Example Co",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(req.PEM)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+	if len(csr.DNSNames) != 1 || csr.DNSNames[0] != "gen-csr.example.test" {
+		t.Errorf("bad DNSNames: %v", csr.DNSNames)
+	}
+	if len(csr.IPAddresses) != 1 || csr.IPAddresses[0].String() != "10.0.0.1" {
+		t.Errorf("bad IPAddresses: %v", csr.IPAddresses)
+	}
+	if csr.Subject.CommonName != "gen-csr.example.test" || csr.Subject.Organization[0] != "Example Co" {
+		t.Errorf("bad Subject: %v", csr.Subject)
+	}
+	keyBlock, _ := pem.Decode(req.KeyPEM)
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.(*ecdsa.PrivateKey).PublicKey.Equal(csr.PublicKey) {
+		t.Error("expected CSR to be for the returned private key")
+	}
+}
+
+func TestGenerateCSRDER(t *testing.T) {
+	csr, err := GenerateCSR(Config{Hosts: []string{"new-csr.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(csr.PEM)
+	if block == nil || !bytes.Equal(block.Bytes, csr.DER) {
+		t.Fatal("expected DER to be the contents of the PEM encoded CSR")
+	}
+	req, err := x509.ParseCertificateRequest(csr.DER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.DNSNames) != 1 || req.DNSNames[0] != "new-csr.example.test" {
+		t.Errorf("bad DNSNames: %v", req.DNSNames)
+	}
+	if keyBlock, _ := pem.Decode(csr.KeyPEM); keyBlock == nil {
+		t.Error("expected a PEM encoded private key")
+	}
+}
+
+func TestSignCSRValidates(t *testing.T) {
+	rootCerts, err := Generate(Config{Hosts: []string{"csr.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := GenerateCSR(Config{Hosts: []string{"csr.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = SignCSR(csr.PEM, Config{
+		LeafValidFor:        time.Hour,
+		LeafNotAfter:        time.Now().Add(24 * time.Hour),
+		RootCACertPEM:       rootCerts.Root.PublicBytes,
+		RootCAPrivateKeyPEM: rootCerts.Root.PrivateBytes,
+	})
+	if err == nil {
+		t.Error("expected an error setting both LeafValidFor and LeafNotAfter")
+	}
+}
+
+func TestGenerateCSRValidates(t *testing.T) {
+	_, err := GenerateCSR(Config{
+		Hosts:        []string{"new-csr.example.test"},
+		LeafValidFor: time.Hour,
+		LeafNotAfter: time.Now().Add(24 * time.Hour),
+	})
+	if err == nil {
+		t.Error("expected an error setting both LeafValidFor and LeafNotAfter")
+	}
+}
+
+func TestSignCSRLeafOptions(t *testing.T) {
+	rootCerts, err := Generate(Config{Hosts: []string{"csr.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := GenerateCSR(Config{Hosts: []string{"csr.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := SignCSR(csr.PEM, Config{
+		DualUsage:           true,
+		MustStaple:          true,
+		OCSPServer:          []string{"http://ocsp.example.test"},
+		RootCACertPEM:       rootCerts.Root.PublicBytes,
+		RootCAPrivateKeyPEM: rootCerts.Root.PrivateBytes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := cert.Certificate
+	want := []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	if len(leaf.ExtKeyUsage) != 2 || leaf.ExtKeyUsage[0] != want[0] || leaf.ExtKeyUsage[1] != want[1] {
+		t.Errorf("ExtKeyUsage: got %v, want %v", leaf.ExtKeyUsage, want)
+	}
+	var mustStaple bool
+	for _, ext := range leaf.Extensions {
+		if ext.Id.Equal(oidTLSFeature) {
+			mustStaple = true
+		}
+	}
+	if !mustStaple {
+		t.Error("expected the TLS Feature extension for MustStaple")
+	}
+	if len(leaf.OCSPServer) != 1 || leaf.OCSPServer[0] != "http://ocsp.example.test" {
+		t.Errorf("OCSPServer: got %v", leaf.OCSPServer)
+	}
+	if len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != "csr.example.test" {
+		t.Errorf("expected the SANs from the CSR, got %v", leaf.DNSNames)
+	}
+}
@@ -0,0 +1,84 @@
+package gencert
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// An Issuer signs leaf certs with a CA that has already been parsed, so
+// callers issuing many certs from the same root don't pay to decode and parse
+// it each time, as Generate does when loading a root from RootCACertPEM. An
+// Issuer is safe for concurrent use.
+type Issuer struct {
+	template *x509.Certificate
+	key      crypto.Signer
+}
+
+// NewIssuer returns an Issuer that signs certs with ca, typically
+// Certs.Root or Certs.Intermediate from an earlier call to Generate. ca must
+// be a CA cert with an unencrypted private key.
+func NewIssuer(ca *Cert) (*Issuer, error) {
+	if ca == nil || ca.Public == nil || ca.Private == nil {
+		return nil, errors.New("gencert: issuer must have a certificate and private key")
+	}
+	if ca.Private.Type == "ENCRYPTED PRIVATE KEY" {
+		return nil, errors.New("gencert: issuer private key is encrypted")
+	}
+	cert := ca.Certificate
+	if cert == nil {
+		var err error
+		cert, err = x509.ParseCertificate(ca.Public.Bytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !cert.IsCA {
+		return nil, errors.New("gencert: issuer certificate is not a CA")
+	}
+	key, err := parsePrivateKey(ca.Private)
+	if err != nil {
+		return nil, err
+	}
+	template, err := issuerTemplate(cert)
+	if err != nil {
+		return nil, err
+	}
+	return &Issuer{template: template, key: key}, nil
+}
+
+// IssueLeaf issues a leaf cert with a new key, signed by the issuer's CA. The
+// hosts and other settings are taken from cfg as they would be for Generate;
+// cfg must not set a root CA to load.
+func (i *Issuer) IssueLeaf(cfg Config) (*Cert, error) {
+	if cfg.loadsRoot() || cfg.checkRootPair() != nil {
+		return nil, errors.New("gencert: cannot set a root CA in the config for an Issuer")
+	}
+	// Validate checks SignatureAlgorithm against KeyType, as if the leaf's
+	// own key type signed it, so leave that to the check against the
+	// issuer's key below.
+	vcfg := cfg
+	vcfg.SignatureAlgorithm = x509.UnknownSignatureAlgorithm
+	if err := vcfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg = cfg.withDefaults()
+	if err := cfg.checkKeyStrength(i.key.Public()); err != nil {
+		return nil, fmt.Errorf("issuer key: %w", err)
+	}
+	if cfg.SignatureAlgorithm != x509.UnknownSignatureAlgorithm {
+		if err := checkSignatureAlgorithm(cfg.SignatureAlgorithm, i.key); err != nil {
+			return nil, err
+		}
+	}
+	template, err := cfg.leafTemplate()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.checkLeafIsCA(i.template); err != nil {
+		return nil, err
+	}
+	leaf, _, err := genCert(cfg, template, i.template, i.key, nil)
+	return leaf, err
+}
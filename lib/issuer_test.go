@@ -0,0 +1,110 @@
+package gencert
+
+import (
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssuer(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"issuer.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := NewIssuer(certs.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"a.example.test", "b.example.test"} {
+		leaf, err := issuer.IssueLeaf(Config{Hosts: []string{host}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := leaf.Certificate.CheckSignatureFrom(certs.Root.Certificate); err != nil {
+			t.Fatal(err)
+		}
+		if err := leaf.Certificate.VerifyHostname(host); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := issuer.IssueLeaf(Config{
+		Hosts:               []string{"issuer.example.test"},
+		RootCACertPEM:       certs.Root.PublicBytes,
+		RootCAPrivateKeyPEM: certs.Root.PrivateBytes,
+	}); err == nil {
+		t.Error("expected an error setting a root CA in the issuer's config")
+	}
+	if _, err := issuer.IssueLeaf(Config{
+		Hosts:              []string{"issuer.example.test"},
+		SignatureAlgorithm: x509.SHA256WithRSA,
+	}); err == nil || !strings.Contains(err.Error(), "issuer's ecdsa key") {
+		t.Errorf("expected an error using an RSA signature algorithm with an ECDSA issuer, got %v", err)
+	}
+}
+
+func TestNewIssuerErrors(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:       []string{"issuer.example.test"},
+		KeyPassword: "hunter2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewIssuer(certs.Root); err == nil {
+		t.Error("expected an error creating an issuer with an encrypted key")
+	}
+	certs, err = Generate(Config{Hosts: []string{"issuer.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewIssuer(certs.Leaf); err == nil {
+		t.Error("expected an error creating an issuer from a non-CA cert")
+	}
+}
+
+func BenchmarkIssueLeaf(b *testing.B) {
+	certs, err := Generate(Config{Hosts: []string{"issuer.example.test"}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	issuer, err := NewIssuer(certs.Root)
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfg := Config{Hosts: []string{"issuer.example.test"}}
+	for i := 0; i < b.N; i++ {
+		if _, err := issuer.IssueLeaf(cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestIssueLeafValidates(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"issuer.example.test"}, KeyType: KeyRSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := NewIssuer(certs.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.IssueLeaf(Config{
+		Hosts:        []string{"issuer.example.test"},
+		LeafValidFor: time.Hour,
+		LeafNotAfter: time.Now().Add(24 * time.Hour),
+	}); err == nil {
+		t.Error("expected an error setting both LeafValidFor and LeafNotAfter")
+	}
+	// the issuer's key signs, so an RSA algorithm is fine for an ECDSA leaf
+	leaf, err := issuer.IssueLeaf(Config{
+		Hosts:              []string{"issuer.example.test"},
+		SignatureAlgorithm: x509.SHA384WithRSA,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Certificate.SignatureAlgorithm != x509.SHA384WithRSA {
+		t.Errorf("SignatureAlgorithm: got %v, want %v", leaf.Certificate.SignatureAlgorithm, x509.SHA384WithRSA)
+	}
+}
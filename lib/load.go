@@ -0,0 +1,154 @@
+package gencert
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// LoadCerts reads certs previously written to dir by the generate-cert
+// command. root.pem, leaf.pem and leaf.key are required; root.key,
+// intermediate.pem and intermediate.key, and client.pem and client.key are
+// read if they exist. Private keys are loaded as is, so encrypted keys stay
+// encrypted.
+func LoadCerts(dir string) (*Certs, error) {
+	root, err := loadCert(dir, "root", true, false)
+	if err != nil {
+		return nil, err
+	}
+	intermediate, err := loadCert(dir, "intermediate", false, false)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := loadCert(dir, "leaf", true, true)
+	if err != nil {
+		return nil, err
+	}
+	client, err := loadCert(dir, "client", false, false)
+	if err != nil {
+		return nil, err
+	}
+	return &Certs{
+		Root:         root,
+		Intermediate: intermediate,
+		Leaf:         leaf,
+		Client:       client,
+	}, nil
+}
+
+// loadCert reads stem.pem and stem.key from dir. If the cert is not required
+// and doesn't exist, it returns nil. If the key is not required and doesn't
+// exist, the returned Cert has no private key.
+func loadCert(dir, stem string, certRequired, keyRequired bool) (*Cert, error) {
+	certPath := filepath.Join(dir, stem+".pem")
+	certdata, err := ioutil.ReadFile(certPath)
+	if os.IsNotExist(err) && !certRequired {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	certBlock, _ := pem.Decode(certdata)
+	if certBlock == nil || certBlock.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("gencert: could not decode %q as a PEM encoded certificate", certPath)
+	}
+	cert, err := certFromBlock(certBlock)
+	if err != nil {
+		return nil, fmt.Errorf("gencert: could not parse %q: %v", certPath, err)
+	}
+
+	keyPath := filepath.Join(dir, stem+".key")
+	keydata, err := ioutil.ReadFile(keyPath)
+	if os.IsNotExist(err) && !keyRequired {
+		return cert, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keyBlock, _ := pem.Decode(keydata)
+	if keyBlock == nil {
+		return nil, fmt.Errorf("gencert: could not decode %q as a PEM encoded private key", keyPath)
+	}
+	cert.setPrivate(keyBlock)
+	return cert, nil
+}
+
+// ParseCertPEM parses a certificate and its private key from pemBytes, which
+// holds both, in any order, as in the files written with --haproxy. The first
+// CERTIFICATE block is used; any others, like the CA chain, are ignored. The
+// private key may be PKCS#8, SEC1 or PKCS#1 encoded, and is loaded as is, so
+// an encrypted key stays encrypted. Unencrypted keys are checked against the
+// certificate.
+func ParseCertPEM(pemBytes []byte) (*Cert, error) {
+	var cert *Cert
+	var keyBlock *pem.Block
+	for rest := pemBytes; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			if cert != nil {
+				continue
+			}
+			var err error
+			cert, err = certFromBlock(block)
+			if err != nil {
+				return nil, err
+			}
+		case "PRIVATE KEY", "EC PRIVATE KEY", "RSA PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+			if keyBlock != nil {
+				return nil, errors.New("gencert: found more than one private key")
+			}
+			keyBlock = block
+		}
+	}
+	if cert == nil {
+		return nil, errors.New("gencert: no CERTIFICATE block found")
+	}
+	if keyBlock == nil {
+		return nil, errors.New("gencert: no private key block found")
+	}
+	if keyBlock.Type != "ENCRYPTED PRIVATE KEY" {
+		key, err := parsePrivateKey(keyBlock)
+		if err != nil {
+			return nil, err
+		}
+		if pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool }); ok && !pub.Equal(cert.Certificate.PublicKey) {
+			return nil, errors.New("gencert: private key does not match the certificate")
+		}
+	}
+	cert.setPrivate(keyBlock)
+	return cert, nil
+}
+
+// certFromBlock returns a Cert with the certificate in block, and no private
+// key.
+func certFromBlock(block *pem.Block) (*Cert, error) {
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &Cert{
+		Public:      block,
+		PublicBytes: pem.EncodeToMemory(block),
+		PublicDER:   block.Bytes,
+		NotBefore:   parsed.NotBefore,
+		NotAfter:    parsed.NotAfter,
+		Certificate: parsed,
+	}, nil
+}
+
+// setPrivate sets c's private key to the PEM block keyBlock.
+func (c *Cert) setPrivate(keyBlock *pem.Block) {
+	c.Private = keyBlock
+	c.PrivateBytes = pem.EncodeToMemory(keyBlock)
+	c.PrivateDER = keyBlock.Bytes
+}
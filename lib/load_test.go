@@ -0,0 +1,131 @@
+package gencert
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCerts(t *testing.T, certs *Certs) string {
+	t.Helper()
+	dir := t.TempDir()
+	for stem, c := range map[string]*Cert{
+		"root":         certs.Root,
+		"intermediate": certs.Intermediate,
+		"leaf":         certs.Leaf,
+		"client":       certs.Client,
+	} {
+		if c == nil {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, stem+".pem"), c.PublicBytes, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, stem+".key"), c.PrivateBytes, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadCerts(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:        []string{"load.example.test"},
+		Intermediate: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := writeCerts(t, certs)
+	loaded, err := LoadCerts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name      string
+		want, got *Cert
+	}{
+		{"root", certs.Root, loaded.Root},
+		{"intermediate", certs.Intermediate, loaded.Intermediate},
+		{"leaf", certs.Leaf, loaded.Leaf},
+		{"client", certs.Client, loaded.Client},
+	} {
+		if tc.got == nil {
+			t.Fatalf("%s: expected cert to be loaded", tc.name)
+		}
+		if !bytes.Equal(tc.got.PublicBytes, tc.want.PublicBytes) || !bytes.Equal(tc.got.PrivateDER, tc.want.PrivateDER) {
+			t.Errorf("%s: loaded cert does not match the generated one", tc.name)
+		}
+		if tc.got.Certificate == nil || !tc.got.NotAfter.Equal(tc.want.NotAfter) {
+			t.Errorf("%s: expected parsed fields to be populated", tc.name)
+		}
+	}
+	if err := loaded.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadCertsOptionalFiles(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:      []string{"load.example.test"},
+		SkipClient: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := writeCerts(t, certs)
+	if err := os.Remove(filepath.Join(dir, "root.key")); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCerts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Intermediate != nil || loaded.Client != nil {
+		t.Error("expected missing intermediate and client to be nil")
+	}
+	if loaded.Root.Private != nil {
+		t.Error("expected root without a key file to have no private key")
+	}
+
+	if err := os.Remove(filepath.Join(dir, "leaf.key")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCerts(dir); err == nil {
+		t.Error("expected an error loading certs without leaf.key")
+	}
+}
+
+func TestParseCertPEM(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:        []string{"parse.example.test"},
+		Intermediate: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParseCertPEM(certs.HAProxyPEM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cert.PublicDER, certs.Leaf.PublicDER) {
+		t.Error("expected the first certificate to be the leaf")
+	}
+	if !bytes.Equal(cert.PrivateDER, certs.Leaf.PrivateDER) {
+		t.Error("expected the leaf private key")
+	}
+
+	// the key may come after the cert
+	pemBytes := append(append([]byte{}, certs.Client.PublicBytes...), certs.Client.PrivateBytes...)
+	if _, err := ParseCertPEM(pemBytes); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseCertPEM(certs.Leaf.PublicBytes); err == nil {
+		t.Error("expected an error parsing a cert without a private key")
+	}
+	mismatched := append(append([]byte{}, certs.Leaf.PublicBytes...), certs.Client.PrivateBytes...)
+	if _, err := ParseCertPEM(mismatched); err == nil {
+		t.Error("expected an error parsing a cert with another cert's private key")
+	}
+}
@@ -0,0 +1,35 @@
+package gencert
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// PKCS12 bundles the leaf certificate, its private key, and the CA chain
+// (the intermediate, if there is one, and the root) into a PKCS#12 (.p12 or
+// .pfx) file encrypted with password, suitable for importing into Windows or a
+// Java keystore. The leaf private key must not be encrypted. It returns
+// ErrNoLeaf if there is no leaf cert.
+func (c *Certs) PKCS12(password string) ([]byte, error) {
+	if c.Leaf == nil {
+		return nil, ErrNoLeaf
+	}
+	if c.Leaf.Private != nil && c.Leaf.Private.Type == "ENCRYPTED PRIVATE KEY" {
+		return nil, errors.New("gencert: cannot bundle an encrypted leaf private key in PKCS#12, generate it without KeyPassword")
+	}
+	key, err := parsePrivateKey(c.Leaf.Private)
+	if err != nil {
+		return nil, fmt.Errorf("gencert: could not parse leaf private key: %v", err)
+	}
+	var caCerts []*x509.Certificate
+	for _, ca := range []*Cert{c.Intermediate, c.Root} {
+		if ca == nil {
+			continue
+		}
+		caCerts = append(caCerts, ca.Certificate)
+	}
+	return pkcs12.Modern.Encode(key, c.Leaf.Certificate, caCerts, password)
+}
@@ -0,0 +1,61 @@
+package gencert
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+)
+
+var (
+	oidPKCS7Data       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS7SignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// The PKCS#7 structures from RFC 2315, with only the fields needed for a
+// "certs-only" bundle.
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional"`
+	SignerInfos      []asn1.RawValue `asn1:"set"`
+}
+
+// PKCS7 returns a DER encoded PKCS#7 (.p7b) "certs-only" bundle containing
+// the leaf, intermediate (if there is one) and root certificates, without any
+// private keys. This is a SignedData structure with no content or signers, as
+// expected by Windows and Java certificate import tools.
+func (c *Certs) PKCS7() ([]byte, error) {
+	var certs []byte
+	for _, cert := range []*Cert{c.Leaf, c.Intermediate, c.Root} {
+		if cert != nil {
+			certs = append(certs, cert.PublicDER...)
+		}
+	}
+	signedData, err := asn1.Marshal(pkcs7SignedData{
+		Version:     1,
+		ContentInfo: pkcs7ContentInfo{ContentType: oidPKCS7Data},
+		Certificates: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      certs,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkcs7ContentInfo{
+		ContentType: oidPKCS7SignedData,
+		Content: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      signedData,
+		},
+	})
+}
@@ -0,0 +1,49 @@
+package gencert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestPKCS7(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:        []string{"p7b.example.test"},
+		Intermediate: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := certs.PKCS7()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ci pkcs7ContentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil || len(rest) != 0 {
+		t.Fatalf("could not parse ContentInfo: %v", err)
+	}
+	if !ci.ContentType.Equal(oidPKCS7SignedData) {
+		t.Fatalf("expected signedData content type, got %v", ci.ContentType)
+	}
+	var sd pkcs7SignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		t.Fatal(err)
+	}
+	if len(sd.SignerInfos) != 0 {
+		t.Error("expected no signers")
+	}
+	parsed, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Cert{certs.Leaf, certs.Intermediate, certs.Root}
+	if len(parsed) != len(want) {
+		t.Fatalf("expected %d certs, got %d", len(want), len(parsed))
+	}
+	for i := range want {
+		if !bytes.Equal(parsed[i].Raw, want[i].PublicDER) {
+			t.Errorf("cert %d does not match", i)
+		}
+	}
+}
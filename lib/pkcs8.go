@@ -0,0 +1,197 @@
+package gencert
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Parameters for encrypting private keys, per RFC 8018. We use PBES2 with
+// PBKDF2-HMAC-SHA256 and AES-256-CBC, which is what `openssl pkcs8 -topk8
+// -v2 aes-256-cbc` produces and what most modern tools can read.
+const (
+	pbkdf2Iterations = 100000
+	pbkdf2SaltLen    = 16
+)
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	PRF            pkix.AlgorithmIdentifier
+}
+
+// pbkdf2DecodeParams is pbkdf2Params with the optional fields that other
+// tools may write, for decoding.
+type pbkdf2DecodeParams struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// errWrongPassword is returned by decryptPKCS8 when the key can't be decrypted
+// with the password.
+var errWrongPassword = errors.New("gencert: could not decrypt private key, the password may be wrong")
+
+// encryptPKCS8 encrypts a DER encoded PKCS#8 private key with password, reading
+// the salt and IV from rand, and returns an "ENCRYPTED PRIVATE KEY" PEM block.
+func encryptPKCS8(rand io.Reader, der []byte, password string) (*pem.Block, error) {
+	salt := make([]byte, pbkdf2SaltLen)
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand, iv); err != nil {
+		return nil, err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	// PKCS#7 padding; there is always at least one byte of padding.
+	padLen := aes.BlockSize - len(der)%aes.BlockSize
+	data := make([]byte, len(der), len(der)+padLen)
+	copy(data, der)
+	for i := 0; i < padLen; i++ {
+		data = append(data, byte(padLen))
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: pbkdf2Iterations,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivParams, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParams}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	b, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: b}, nil
+}
+
+// decryptPKCS8 decrypts the DER encoded EncryptedPrivateKeyInfo in der with
+// password, returning the DER encoded PKCS#8 private key. Only PBES2 with
+// PBKDF2 (HMAC-SHA1 or HMAC-SHA256) and AES-CBC is supported, which covers
+// keys written by encryptPKCS8 and by `openssl pkcs8 -topk8 -v2`.
+func decryptPKCS8(der []byte, password string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("gencert: unsupported private key encryption algorithm %v", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("gencert: unsupported key derivation function %v", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdfParams pbkdf2DecodeParams
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, err
+	}
+	h := sha1.New
+	switch prf := kdfParams.PRF.Algorithm; {
+	case prf == nil || prf.Equal(oidHMACWithSHA1):
+		// HMAC-SHA1 is the default
+	case prf.Equal(oidHMACWithSHA256):
+		h = sha256.New
+	default:
+		return nil, fmt.Errorf("gencert: unsupported PBKDF2 pseudorandom function %v", prf)
+	}
+	var keyLen int
+	switch alg := params.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keyLen = 16
+	case alg.Equal(oidAES192CBC):
+		keyLen = 24
+	case alg.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("gencert: unsupported private key encryption scheme %v", alg)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, errors.New("gencert: invalid AES-CBC IV in encrypted private key")
+	}
+	key, err := pbkdf2.Key(h, password, kdfParams.Salt, kdfParams.IterationCount, keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data := info.EncryptedData
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("gencert: invalid encrypted private key length")
+	}
+	data = append([]byte(nil), data...)
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+	// check and strip the PKCS#7 padding; bad padding almost always means
+	// the password was wrong.
+	padLen := int(data[len(data)-1])
+	if padLen == 0 || padLen > aes.BlockSize {
+		return nil, errWrongPassword
+	}
+	for _, b := range data[len(data)-padLen:] {
+		if int(b) != padLen {
+			return nil, errWrongPassword
+		}
+	}
+	return data[:len(data)-padLen], nil
+}
@@ -0,0 +1,68 @@
+package gencert
+
+import (
+	"encoding/pem"
+	"errors"
+)
+
+// RenewLeaf issues a new leaf cert for the existing PEM encoded private key in
+// existingLeafKeyPEM, signed by the root CA configured in cfg. The cert gets a
+// fresh serial number and validity period, but keeps the same public key, so
+// clients that pin the key keep working. The hosts and other settings are
+// taken from cfg as they would be for Generate.
+func RenewLeaf(existingLeafKeyPEM []byte, cfg Config) (*Cert, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if !cfg.loadsRoot() {
+		return nil, errors.New("gencert: must set a root CA to sign the renewed cert with")
+	}
+	cfg = cfg.withDefaults()
+
+	block, _ := pem.Decode(existingLeafKeyPEM)
+	if block == nil {
+		return nil, errors.New("gencert: could not decode existing leaf key as PEM")
+	}
+	key, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, err
+	}
+	template, err := cfg.leafTemplate()
+	if err != nil {
+		return nil, err
+	}
+	_, rootTemplate, rootKey, err := loadRoot(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.checkLeafIsCA(rootTemplate); err != nil {
+		return nil, err
+	}
+	leaf, _, err := genCert(cfg, template, rootTemplate, rootKey, key)
+	return leaf, err
+}
+
+// GenerateClient issues a new client cert with a new key, signed by the root
+// CA configured in cfg, without generating anything else. Use it to rotate
+// client certs on a different schedule than the leaf cert. The hosts and other
+// settings are taken from cfg as they would be for Generate.
+func GenerateClient(cfg Config) (*Cert, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if !cfg.loadsRoot() {
+		return nil, errors.New("gencert: must set a root CA to sign the client cert with")
+	}
+	cfg = cfg.withDefaults()
+
+	template, err := cfg.clientTemplate()
+	if err != nil {
+		return nil, err
+	}
+	_, rootTemplate, rootKey, err := loadRoot(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, _, err := genCert(cfg, template, rootTemplate, rootKey, nil)
+	return client, err
+}
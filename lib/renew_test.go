@@ -0,0 +1,145 @@
+package gencert
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRenewLeaf(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"renew.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notBefore := time.Now().Add(time.Hour).Truncate(time.Second)
+	renewed, err := RenewLeaf(certs.Leaf.PrivateBytes, Config{
+		Hosts:               []string{"renew.example.test"},
+		NotBefore:           notBefore,
+		RootCACertPEM:       certs.Root.PublicBytes,
+		RootCAPrivateKeyPEM: certs.Root.PrivateBytes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(renewed.PrivateDER, certs.Leaf.PrivateDER) {
+		t.Error("expected renewed leaf to keep the same private key")
+	}
+	if !renewed.NotBefore.Equal(notBefore) {
+		t.Errorf("NotBefore: got %v, want %v", renewed.NotBefore, notBefore)
+	}
+	old, err := x509.ParseCertificate(certs.Leaf.PublicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(renewed.PublicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(leaf.RawSubjectPublicKeyInfo, old.RawSubjectPublicKeyInfo) {
+		t.Error("expected renewed leaf to have the same public key")
+	}
+	if leaf.SerialNumber.Cmp(old.SerialNumber) == 0 {
+		t.Error("expected renewed leaf to have a new serial number")
+	}
+	root, err := x509.ParseCertificate(certs.Root.PublicDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.CheckSignatureFrom(root); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenewLeafRequiresRoot(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"renew.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RenewLeaf(certs.Leaf.PrivateBytes, Config{Hosts: []string{"renew.example.test"}}); err == nil {
+		t.Fatal("expected an error renewing without a root CA")
+	}
+}
+
+func TestGenerateClient(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"client.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := GenerateClient(Config{
+		Hosts:               []string{"client.example.test"},
+		RootCACertPEM:       certs.Root.PublicBytes,
+		RootCAPrivateKeyPEM: certs.Root.PrivateBytes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(client.PrivateDER, certs.Client.PrivateDER) {
+		t.Error("expected the client cert to get a new private key")
+	}
+	if got := client.Certificate.ExtKeyUsage; len(got) != 1 || got[0] != x509.ExtKeyUsageClientAuth {
+		t.Errorf("ExtKeyUsage: got %v, want client auth", got)
+	}
+	if err := client.Certificate.CheckSignatureFrom(certs.Root.Certificate); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateClient(Config{Hosts: []string{"client.example.test"}}); err == nil {
+		t.Error("expected an error generating a client cert without a root CA")
+	}
+}
+
+func TestRenewLeafRootSigner(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"renew.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(certs.Root.PrivateDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{
+		Hosts:           []string{"renew.example.test"},
+		RootCertificate: certs.Root.Certificate,
+		RootSigner:      opaqueSigner{key.(crypto.Signer)},
+	}
+	renewed, err := RenewLeaf(certs.Leaf.PrivateBytes, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := renewed.Certificate.CheckSignatureFrom(certs.Root.Certificate); err != nil {
+		t.Fatal(err)
+	}
+	client, err := GenerateClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Certificate.CheckSignatureFrom(certs.Root.Certificate); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenewLeafValidates(t *testing.T) {
+	certs, err := Generate(Config{Hosts: []string{"renew.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := Config{
+		Hosts:               []string{"renew.example.test"},
+		RootCACertPEM:       certs.Root.PublicBytes,
+		RootCAPrivateKeyPEM: certs.Root.PrivateBytes,
+	}
+	cfg := root
+	cfg.LeafValidFor = time.Hour
+	cfg.LeafNotAfter = time.Now().Add(24 * time.Hour)
+	if _, err := RenewLeaf(certs.Leaf.PrivateBytes, cfg); err == nil {
+		t.Error("expected an error setting both LeafValidFor and LeafNotAfter")
+	}
+	cfg = root
+	cfg.StrictValidity = true
+	cfg.LeafValidFor = 5 * 365 * 24 * time.Hour
+	if _, err := RenewLeaf(certs.Leaf.PrivateBytes, cfg); !errors.Is(err, ErrLeafValidForTooLong) {
+		t.Errorf("expected ErrLeafValidForTooLong with StrictValidity, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package gencert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+)
+
+// TLSCertificate returns c and its private key as a tls.Certificate, ready for
+// tls.Config.Certificates, with Leaf set to the parsed certificate. Any
+// intermediates are sent after c in the chain, e.g. pass Certs.Intermediate
+// when there is one. The private key must not be encrypted.
+func (c *Cert) TLSCertificate(intermediates ...*Cert) (tls.Certificate, error) {
+	chain := append([]byte{}, c.PublicBytes...)
+	for _, intermediate := range intermediates {
+		chain = append(chain, intermediate.PublicBytes...)
+	}
+	cert, err := tls.X509KeyPair(chain, c.PrivateBytes)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	cert.Leaf = c.Certificate
+	return cert, nil
+}
+
+// keyPair loads cert as a tls.Certificate, including the intermediate in the
+// chain if there is one.
+func (c *Certs) keyPair(cert *Cert) (tls.Certificate, error) {
+	if c.Intermediate != nil {
+		return cert.TLSCertificate(c.Intermediate)
+	}
+	return cert.TLSCertificate()
+}
+
+// rootPool returns a CertPool containing only the root CA.
+func (c *Certs) rootPool() (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(c.Root.PublicBytes) {
+		return nil, errors.New("gencert: could not parse root certificate")
+	}
+	return pool, nil
+}
+
+// ServerTLSConfig returns a TLS config for a server presenting the leaf cert.
+// ClientCAs is set to the root CA, so setting ClientAuth on the returned
+// config is enough to require client certs signed by the root. It returns
+// ErrNoLeaf if there is no leaf cert.
+func (c *Certs) ServerTLSConfig() (*tls.Config, error) {
+	if c.Leaf == nil {
+		return nil, ErrNoLeaf
+	}
+	cert, err := c.keyPair(c.Leaf)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := c.rootPool()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+	}, nil
+}
+
+// ClientTLSConfig returns a TLS config for a client that trusts the root CA
+// and presents the client cert, if there is one.
+func (c *Certs) ClientTLSConfig() (*tls.Config, error) {
+	pool, err := c.rootPool()
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{RootCAs: pool}
+	if c.Client != nil {
+		cert, err := c.keyPair(c.Client)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,80 @@
+package gencert
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSConfigs(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:        []string{"127.0.0.1"},
+		Intermediate: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig, err := certs.ServerTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	clientConfig, err := certs.ClientTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	s.TLS = serverConfig
+	s.StartTLS()
+	defer s.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+	resp, err := client.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "127.0.0.1" {
+		t.Errorf("expected server to see client cert for 127.0.0.1, got %q", body)
+	}
+}
+
+func TestTLSCertificate(t *testing.T) {
+	certs, err := Generate(Config{
+		Hosts:        []string{"tls-certificate.example.test"},
+		Intermediate: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := certs.Leaf.TLSCertificate(certs.Intermediate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.Certificate) != 2 {
+		t.Fatalf("expected the leaf and intermediate in the chain, got %d certs", len(cert.Certificate))
+	}
+	if !bytes.Equal(cert.Certificate[1], certs.Intermediate.PublicDER) {
+		t.Error("expected the intermediate second in the chain")
+	}
+	if cert.Leaf == nil || !bytes.Equal(cert.Leaf.Raw, certs.Leaf.PublicDER) {
+		t.Error("expected Leaf to be the parsed leaf certificate")
+	}
+	cert, err = certs.Client.TLSCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.Certificate) != 1 {
+		t.Errorf("expected only the client cert in the chain, got %d certs", len(cert.Certificate))
+	}
+}
@@ -2,89 +2,810 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/elliptic"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"math/big"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	gencert "github.com/meterup/generate-cert/lib"
+	"golang.org/x/net/idna"
 )
 
-func writeCert(c *gencert.Cert, rootFilename string) error {
-	pubkey := rootFilename + ".pem"
-	if err := ioutil.WriteFile(pubkey, c.PublicBytes, 0666); err != nil {
+// output decides where generated files are written.
+type output struct {
+	// Directory to write files to.
+	dir string
+	// Prefix for the names of written files, e.g. "api-" for api-leaf.pem.
+	prefix string
+	// Write certs and keys as "pem", raw "der" or single-line "base64"
+	// DER.
+	format string
+	// Write PEM files with "\r\n" line endings, for Windows tools.
+	crlf bool
+	// If set, write PEM data here instead of to files, each preceded by a
+	// "# name" line.
+	stdout io.Writer
+	// Permissions for certificate and private key files.
+	certPerm, keyPerm os.FileMode
+	// Overwrite files that already exist.
+	force bool
+	// If set, also write a JSON manifest of the written files here.
+	manifest string
+	// Files waiting to be written by commit.
+	pending []pendingFile
+}
+
+type pendingFile struct {
+	path string
+	data []byte
+	perm os.FileMode
+	// What the file holds, e.g. "leaf-key", for the manifest.
+	role string
+	// The cert in the file, or whose key is in it, if any.
+	cert *gencert.Cert
+	// Append data to the file instead of replacing it.
+	append bool
+}
+
+// path returns the path to write the named file to.
+func (o *output) path(name string) string {
+	return filepath.Join(o.dir, o.prefix+name)
+}
+
+// writeFile queues data to be written to the named file in the output
+// directory by commit, or writes it to stdout immediately if that's set. role
+// and c describe the file in the manifest; c may be nil.
+func (o *output) writeFile(name, role string, c *gencert.Cert, data []byte, perm os.FileMode) error {
+	if o.stdout != nil {
+		_, err := fmt.Fprintf(o.stdout, "# %s\n%s", o.prefix+name, data)
+		return err
+	}
+	o.addFile(o.path(name), role, c, data, perm)
+	return nil
+}
+
+// addFile queues data to be written to path by commit.
+func (o *output) addFile(path, role string, c *gencert.Cert, data []byte, perm os.FileMode) {
+	o.pending = append(o.pending, pendingFile{path: path, data: data, perm: perm, role: role, cert: c})
+}
+
+// appendFile queues data to be appended to path by commit, creating it if it
+// doesn't exist.
+func (o *output) appendFile(path, role string, c *gencert.Cert, data []byte, perm os.FileMode) {
+	o.pending = append(o.pending, pendingFile{path: path, data: data, perm: perm, role: role, cert: c, append: true})
+}
+
+// commit writes the queued files. Unless force is set, it doesn't write
+// anything if any of them already exist, so a hand-crafted root or key is
+// never clobbered.
+func (o *output) commit() error {
+	if !o.force {
+		paths := make([]string, 0, len(o.pending)+1)
+		for _, f := range o.pending {
+			if !f.append {
+				paths = append(paths, f.path)
+			}
+		}
+		if o.manifest != "" {
+			paths = append(paths, o.manifest)
+		}
+		var existing []string
+		for _, path := range paths {
+			if _, err := os.Lstat(path); err == nil {
+				existing = append(existing, path)
+			}
+		}
+		if len(existing) > 0 {
+			return fmt.Errorf("refusing to overwrite existing files (pass --force to overwrite them): %s", strings.Join(existing, ", "))
+		}
+	}
+	for i, f := range o.pending {
+		if !f.append {
+			if err := writeFileMode(f.path, f.data, f.perm); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := appendToFile(f.path, f.data, f.perm); err != nil {
+			return err
+		}
+		if o.manifest != "" {
+			// describe the whole file in the manifest, not just the
+			// appended data
+			data, err := ioutil.ReadFile(f.path)
+			if err != nil {
+				return err
+			}
+			o.pending[i].data = data
+		}
+	}
+	if o.manifest != "" {
+		data, err := marshalManifest(o.pending)
+		if err != nil {
+			return err
+		}
+		if err := writeFileMode(o.manifest, data, 0644); err != nil {
+			return err
+		}
+	}
+	o.pending = nil
+	return nil
+}
+
+// writeFileMode writes data to the named file with permissions perm,
+// regardless of the umask or the permissions of an existing file. The data is
+// written to a temporary file that already has perm, which is then renamed
+// into place, so a private key is never readable with an existing file's
+// looser permissions, and a failed write doesn't leave a truncated file.
+func writeFileMode(name string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	err = f.Chmod(perm)
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// appendToFile appends data to the named file, creating it with perm if it
+// doesn't exist, regardless of the umask. An existing file keeps its
+// permissions, since it's usually a shared trust bundle. If the file doesn't
+// end with a newline, one is added first, so PEM blocks aren't run together.
+func appendToFile(name string, data []byte, perm os.FileMode) error {
+	if _, err := os.Lstat(name); os.IsNotExist(err) {
+		return writeFileMode(name, data, perm)
+	}
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if fi.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, fi.Size()-1); err == nil && last[0] != '\n' {
+			data = append([]byte("\n"), data...)
+		}
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parsePerm parses an octal file mode flag value like "0644".
+func parsePerm(flagName, s string) (os.FileMode, error) {
+	perm, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || perm > 0777 {
+		return 0, fmt.Errorf("invalid --%s %q, must be an octal file mode like 0644", flagName, s)
+	}
+	return os.FileMode(perm), nil
+}
+
+// certName returns the name of the certificate file for the given stem.
+func (o *output) certName(stem string) string {
+	if o.format == "der" {
+		return stem + ".der"
+	}
+	return stem + ".pem"
+}
+
+// keyName returns the name of the private key file for the given stem.
+func (o *output) keyName(stem string) string {
+	if o.format == "der" {
+		return stem + ".key.der"
+	}
+	return stem + ".key"
+}
+
+func (o *output) writeCert(c *gencert.Cert, rootFilename string) error {
+	public, private := c.PublicBytes, c.PrivateBytes
+	switch o.format {
+	case "der":
+		public, private = c.PublicDER, c.PrivateDER
+	case "base64":
+		public, private = []byte(c.PublicBase64()+"\n"), []byte(c.PrivateBase64()+"\n")
+	default:
+		if o.crlf {
+			public, private = c.PublicBytesCRLF(), c.PrivateBytesCRLF()
+		}
+	}
+	if err := o.writeFile(o.certName(rootFilename), rootFilename+"-cert", c, public, o.certPerm); err != nil {
 		return err
 	}
-	privkey := rootFilename + ".key"
-	if err := ioutil.WriteFile(privkey, c.PrivateBytes, 0600); err != nil {
+	if err := o.writeFile(o.keyName(rootFilename), rootFilename+"-key", c, private, o.keyPerm); err != nil {
 		return err
 	}
 	return nil
 }
 
+// writeCSR writes the CSR in req, PEM encoded unless der is set, and its
+// private key. It returns the name of the CSR file.
+func (o *output) writeCSR(req *gencert.CSR, der bool) (string, error) {
+	name, data := "leaf.csr", o.pemBytes(req.PEM)
+	if der {
+		name, data = "leaf.csr.der", req.DER
+	}
+	if err := o.writeFile(name, "leaf-csr", nil, data, o.certPerm); err != nil {
+		return "", err
+	}
+	return name, o.writeFile("leaf.key", "leaf-key", nil, o.pemBytes(req.KeyPEM), o.keyPerm)
+}
+
+// pemBytes returns data, the contents of a PEM file, with "\r\n" line endings
+// if crlf is set.
+func (o *output) pemBytes(data []byte) []byte {
+	if !o.crlf {
+		return data
+	}
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
+// serialHex formats a serial number as uppercase colon-separated hex bytes,
+// e.g. "0A:1B:2C", to compare with `openssl x509 -serial`.
+func serialHex(serial *big.Int) string {
+	b := serial.Bytes()
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	parts := make([]string, len(b))
+	for i, c := range b {
+		parts[i] = fmt.Sprintf("%02X", c)
+	}
+	return strings.Join(parts, ":")
+}
+
+// writeSerials writes the serial number of each cert in certs to w.
+func writeSerials(w io.Writer, certs *gencert.Certs) {
+	for _, c := range []struct {
+		name string
+		cert *gencert.Cert
+	}{
+		{"root", certs.Root},
+		{"intermediate", certs.Intermediate},
+		{"leaf", certs.Leaf},
+		{"client", certs.Client},
+	} {
+		if c.cert != nil {
+			fmt.Fprintf(w, "%s serial=%s\n", c.name, serialHex(c.cert.Certificate.SerialNumber))
+		}
+	}
+}
+
+// splitList splits a comma-separated flag value, returning nil if it's empty.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// listFlag is a flag that may be repeated, or given a comma-separated list,
+// to build up a list of values.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, splitList(s)...)
+	return nil
+}
+
+// verifyHostnames checks that the leaf cert is valid for each of hosts, the
+// way a TLS client connecting to it would. Email addresses are skipped, and
+// wildcards are checked with a made up label in place of the "*".
+func verifyHostnames(leaf *gencert.Cert, hosts []string) error {
+	for _, h := range hosts {
+		h = strings.TrimSpace(h)
+		if strings.Contains(h, "@") {
+			continue
+		}
+		h = strings.TrimSuffix(strings.TrimPrefix(h, "["), "]")
+		if strings.HasPrefix(h, "*.") {
+			h = "wildcard-check" + h[1:]
+		}
+		if net.ParseIP(h) == nil {
+			ascii, err := idna.Lookup.ToASCII(h)
+			if err != nil {
+				return fmt.Errorf("could not convert host %q to punycode: %v", h, err)
+			}
+			h = ascii
+		}
+		if err := leaf.Certificate.VerifyHostname(h); err != nil {
+			return fmt.Errorf("generated leaf cert does not match host %q: %v", h, err)
+		}
+	}
+	return nil
+}
+
+// devHosts are added to the host list by --dev.
+var devHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// addHosts appends each of extra to hosts, unless it's already there.
+func addHosts(hosts []string, extra ...string) []string {
+	for _, e := range extra {
+		found := false
+		for _, h := range hosts {
+			if strings.TrimSpace(h) == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			hosts = append(hosts, e)
+		}
+	}
+	return hosts
+}
+
+// parseNotBefore parses an RFC3339 timestamp, or a duration relative to now.
+func parseNotBefore(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not parse --not-before %q as an RFC3339 timestamp or duration", s)
+	}
+	return time.Now().Add(d), nil
+}
+
 func main() {
+	configFile := flag.String("config", "", "Read options from this YAML or JSON file, keyed by flag name; flags set on the command line take precedence")
 	version := flag.Bool("version", false, "Print the version string and exit")
 	host := flag.String("host", "", "Comma-separated hostnames and IPs to generate a certificate for")
+	email := flag.String("email", "", "Comma-separated email addresses to generate a certificate for")
+	uri := flag.String("uri", "", "Comma-separated URIs (e.g. SPIFFE IDs) to generate a certificate for")
 	validFor := flag.Duration("duration", 365*24*time.Hour, "Duration that certificate is valid for")
+	backdate := flag.Duration("backdate", time.Minute, "Make certs valid from this long before now, to allow for clock skew (ignored with --not-before)")
+	notBefore := flag.String("not-before", "", "When certs become valid, as an RFC3339 timestamp or a duration relative to now like -5m (defaults to now)")
+	notAfter := flag.String("not-after", "", "When leaf and client certs expire, as an RFC3339 timestamp, instead of using --duration")
 	rootValidFor := flag.Duration("root-duration", 365*24*time.Hour, "Duration that root CA is valid for")
-	organization := flag.String("organization", "Acme Co", "Company to issue the cert to")
+	organization := flag.String("organization", "Acme Co", "Comma-separated companies (O) to issue the cert to")
+	rootCommonName := flag.String("root-common-name", "", "Common Name to put on the generated root CA cert, e.g. \"Example Internal Root CA 2024\"")
+	noSubjectSerial := flag.Bool("no-subject-serial", false, "Don't copy each cert's serial number into its subject")
+	rootNoEKU := flag.Bool("root-no-eku", false, "Leave the Extended Key Usage extension off the generated root CA cert")
+	rootOrganization := flag.String("root-organization", "", "Company to put on the root and intermediate CA certs (defaults to --organization)")
+	country := flag.String("country", "", "Comma-separated countries (C) to put in the subject")
+	province := flag.String("province", "", "Comma-separated states or provinces (ST) to put in the subject")
+	locality := flag.String("locality", "", "Comma-separated localities (L) to put in the subject")
+	orgUnit := flag.String("organizational-unit", "", "Comma-separated organizational units (OU) to put in the subject")
+	commonName := flag.String("common-name", "", "Common Name to put on the leaf and client certs (defaults to the first --host)")
+	ocsp := flag.String("ocsp", "", "Comma-separated OCSP responder URLs to put on the leaf and client certs")
+	crl := flag.String("crl", "", "Comma-separated CRL distribution point URLs to put on the leaf and client certs")
+	issuerURL := flag.String("issuer-url", "", "Comma-separated URLs of the issuing CA certificate to put on the leaf and client certs")
 	rootCAKey := flag.String("root-ca-key", "", "Use root CA on disk instead of generating one (should be a .key file)")
 	rootCAPEM := flag.String("root-ca-cert", "", "Use root CA certificate on disk instead of generating one (should be a .pem file)")
+	rootCAKeyPassword := flag.String("root-ca-key-password", "", "Password to decrypt the --root-ca-key with, if it's encrypted")
+	keyPassword := flag.String("key-password", "", "Encrypt generated private keys with this password")
+	keyPasswordFile := flag.String("key-password-file", "", "Encrypt generated private keys with the password in this file")
+	intermediate := flag.Bool("intermediate", false, "Sign the leaf and client certs with an intermediate CA, instead of the root CA")
+	intermediateOnly := flag.Bool("intermediate-only", false, "Only generate an intermediate CA, e.g. signed by an offline root loaded with --root-ca-key, and no leaf or client certs")
+	clientValidFor := flag.Duration("client-duration", 0, "Duration that the client certificate is valid for (defaults to --duration)")
+	intermediateValidFor := flag.Duration("intermediate-duration", 0, "Duration that the intermediate CA is valid for (defaults to --root-duration)")
+	fullchain := flag.Bool("fullchain", false, "Also write fullchain.pem, containing the leaf and root certificates")
+	clientFullchain := flag.Bool("chain-file-for-client", false, "Also write client-fullchain.pem, containing the client and root certificates")
+	haproxyFile := flag.String("haproxy", "", "Also write the leaf key, certificate and CA chain to this file, in the format HAProxy expects")
+	pkcs12File := flag.String("pkcs12", "", "Also write the leaf certificate, key and CA chain to this PKCS#12 (.p12/.pfx) file")
+	p7bFile := flag.String("p7b", "", "Also write the leaf and CA certificates, without keys, to this PKCS#7 (.p7b) file")
+	pkcs12Password := flag.String("pkcs12-password", "", "Password to encrypt the --pkcs12 file with")
+	csr := flag.Bool("csr", false, "Generate leaf.csr and leaf.key to send to an external CA, instead of generating certs")
+	csrFormat := flag.String("csr-format", "pem", "Format to write the --csr request in (pem or der, which is written to leaf.csr.der)")
+	outDir := flag.String("out-dir", ".", "Directory to write files to, created if it doesn't exist")
+	prefix := flag.String("prefix", "", "Prefix for the names of written files, e.g. \"api-\" writes api-leaf.pem")
+	certPerm := flag.String("cert-perm", "0644", "Permissions for written certificate files, in octal")
+	keyPerm := flag.String("key-perm", "0600", "Permissions for written private key files, in octal")
+	force := flag.Bool("force", false, "Overwrite output files that already exist")
+	appendTo := flag.String("append-to", "", "Also append the generated root CA certificate to this trust bundle, e.g. ca-bundle.pem, creating it if needed")
+	manifest := flag.String("manifest", "", "Also write a JSON manifest of the written files (path, role, SHA-256 and expiry) to this file")
+	format := flag.String("format", "pem", "Format to write certs and keys in (pem or der)")
+	spkiPin := flag.Bool("spki-pin", false, "Print the base64 SHA-256 SPKI pins of the leaf and root public keys to stderr")
+	printSerial := flag.Bool("print-serial", false, "Print the serial number of each cert to stderr, in colon-separated hex")
+	printFingerprint := flag.Bool("print-fingerprint", false, "Print the SHA-256 fingerprints of the leaf and root certs to stderr")
+	mustStaple := flag.Bool("must-staple", false, "Add the OCSP Must-Staple extension to the leaf cert")
+	ipAsDNS := flag.Bool("ip-as-dns", false, "Also put IP address hosts in the DNS SANs, for old TLS clients that don't check IP SANs (non-standard)")
+	noClient := flag.Bool("no-client", false, "Don't generate a client cert")
+	dualUsage := flag.Bool("dual-usage", false, "Allow the leaf cert to be used for client auth as well as server auth, e.g. in a service mesh")
+	var policyOIDs listFlag
+	flag.Var(&policyOIDs, "policy-oid", "Certificate policy OID to put on the leaf and client certs, e.g. 2.23.140.1.2.1 (may be repeated)")
+	verifyHostname := flag.Bool("verify-hostname", false, "Check that the leaf cert is valid for each --host before writing it")
+	dev := flag.Bool("dev", false, "Also issue the certs for localhost, 127.0.0.1 and ::1, and default --duration to 30 days, for local development")
+	strict := flag.Bool("strict", false, "Fail instead of warning if the leaf cert is valid for longer than browsers accept (398 days)")
+	dryRun := flag.Bool("dry-run", false, "Check the options and describe the certs that would be generated, without generating or writing anything")
+	quiet := flag.Bool("quiet", false, "Don't print the list of written files, only errors")
+	crlf := flag.Bool("crlf", false, "Write PEM files with Windows (\\r\\n) line endings")
+	base64Out := flag.Bool("base64", false, "Print the generated certs and keys to stdout as single-line base64 DER, instead of writing files")
+	toStdout := flag.Bool("stdout", false, "Print the generated certs and keys to stdout as PEM, instead of writing files")
+	k8sSecretName := flag.String("k8s-secret", "", "Print a Kubernetes TLS Secret with this name to stdout, with the leaf cert and key and the root CA, instead of writing files")
+	jsonOut := flag.Bool("json", false, "Print the generated certs and keys to stdout as JSON, instead of writing files")
+	keyType := flag.String("key-type", "ecdsa", "Type of private key to generate (ecdsa, rsa or ed25519)")
+	curve := flag.String("curve", "p256", "Curve to use for ECDSA keys (p256, p384 or p521)")
+	legacyKeyFormat := flag.Bool("legacy-key-format", false, "Write ECDSA and RSA keys as \"EC PRIVATE KEY\" and \"RSA PRIVATE KEY\" blocks instead of PKCS#8")
+	rsaBits := flag.Int("rsa-bits", 2048, "Size of RSA keys to generate, if --key-type=rsa")
+	minRSABits := flag.Int("min-rsa-bits", 2048, "Smallest --rsa-bits to allow")
 	flag.Parse()
+	if *configFile != "" {
+		if err := loadConfigFile(flag.CommandLine, *configFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	hosts := splitList(*host)
+	// flags that were passed, to tell them apart from their defaults
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	if *dev {
+		hosts = addHosts(hosts, devHosts...)
+		if !setFlags["duration"] {
+			*validFor = 30 * 24 * time.Hour
+		}
+	}
 	if *version {
 		fmt.Fprintf(os.Stderr, "generate-cert version %s\n", gencert.Version)
 		os.Exit(0)
 	}
+	if len(hosts) == 0 && *email == "" && *uri == "" && *commonName == "" && !*intermediateOnly {
+		log.Fatal("no hosts to generate a certificate for, pass at least one --host (or --email, --uri or --common-name)")
+	}
 	if *rootCAKey != "" && *rootCAPEM == "" {
 		log.Fatal("must set both --root-ca-key and --root-ca-cert or neither")
 	}
 	if *rootCAKey == "" && *rootCAPEM != "" {
 		log.Fatal("must set both --root-ca-key and --root-ca-cert or neither")
 	}
+	if *rootCAKeyPassword != "" && *rootCAKey == "" {
+		log.Fatal("--root-ca-key-password requires --root-ca-key")
+	}
+	if *k8sSecretName != "" && (*jsonOut || *toStdout || *csr || *intermediateOnly) {
+		log.Fatal("--k8s-secret cannot be used with --json, --stdout, --csr or --intermediate-only")
+	}
+	if *jsonOut {
+		for _, name := range []string{"stdout", "base64", "csr", "fullchain", "chain-file-for-client", "haproxy", "pkcs12", "p7b", "manifest", "append-to", "out-dir", "prefix"} {
+			if setFlags[name] {
+				log.Fatalf("--json prints the certs instead of writing files, so cannot be used with --%s", name)
+			}
+		}
+	}
+	if *appendTo != "" && (*rootCAKey != "" || *csr) {
+		log.Fatal("--append-to only adds a newly generated root CA, so cannot be used with --root-ca-key or --csr")
+	}
+	if *keyPassword != "" && *keyPasswordFile != "" {
+		log.Fatal("cannot set both --key-password and --key-password-file")
+	}
+	if *keyPasswordFile != "" {
+		data, err := ioutil.ReadFile(*keyPasswordFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		*keyPassword = strings.TrimRight(string(data), "\r\n")
+	}
+	if *pkcs12File != "" && *keyPassword != "" {
+		log.Fatal("--pkcs12 cannot be used with --key-password or --key-password-file, since the PKCS#12 bundle needs the unencrypted leaf key; it's encrypted with --pkcs12-password instead")
+	}
+	nb, err := parseNotBefore(*notBefore)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var kt gencert.KeyType
+	switch *keyType {
+	case "ecdsa":
+		kt = gencert.KeyECDSA
+	case "rsa":
+		kt = gencert.KeyRSA
+	case "ed25519":
+		kt = gencert.KeyEd25519
+	default:
+		log.Fatalf("unknown --key-type %q, must be ecdsa, rsa or ed25519", *keyType)
+	}
+	var c elliptic.Curve
+	switch *curve {
+	case "p256":
+		c = elliptic.P256()
+	case "p384":
+		c = elliptic.P384()
+	case "p521":
+		c = elliptic.P521()
+	default:
+		log.Fatalf("unknown --curve %q, must be p256, p384 or p521", *curve)
+	}
+	var na time.Time
+	if *notAfter != "" {
+		na, err = time.Parse(time.RFC3339, *notAfter)
+		if err != nil {
+			log.Fatalf("could not parse --not-after %q as an RFC3339 timestamp", *notAfter)
+		}
+		if setFlags["duration"] {
+			log.Fatal("cannot use both --duration and --not-after")
+		}
+		// override default, otherwise it conflicts with --not-after
+		*validFor = 0
+	}
 	if *rootCAKey != "" && *rootValidFor == 365*24*time.Hour {
 		// override default if you passed in a file, otherwise it will fail
 		*rootValidFor = 0
 	}
 
-	hosts := strings.Split(*host, ",")
-	certs, err := gencert.Generate(gencert.Config{
-		Hosts:            hosts,
-		Org:              *organization,
-		RootValidFor:     *rootValidFor,
-		LeafValidFor:     *validFor,
-		RootCAPrivateKey: *rootCAKey,
-		RootCACert:       *rootCAPEM,
-	})
+	cfg := gencert.Config{
+		Hosts:                 hosts,
+		IPAsDNS:               *ipAsDNS,
+		MustStaple:            *mustStaple,
+		EmailAddresses:        splitList(*email),
+		URIs:                  splitList(*uri),
+		Orgs:                  splitList(*organization),
+		RootOrg:               *rootOrganization,
+		RootCommonName:        *rootCommonName,
+		RootNoEKU:             *rootNoEKU,
+		NoSubjectSerial:       *noSubjectSerial,
+		CommonName:            *commonName,
+		Country:               splitList(*country),
+		Province:              splitList(*province),
+		Locality:              splitList(*locality),
+		OrganizationalUnit:    splitList(*orgUnit),
+		OCSPServer:            splitList(*ocsp),
+		CRLDistributionPoints: splitList(*crl),
+		IssuingCertificateURL: splitList(*issuerURL),
+		RootValidFor:          *rootValidFor,
+		IntermediateValidFor:  *intermediateValidFor,
+		ClientValidFor:        *clientValidFor,
+		LeafValidFor:          *validFor,
+		LeafNotAfter:          na,
+		StrictValidity:        *strict,
+		NotBefore:             nb,
+		Backdate:              *backdate,
+		RootCAPrivateKey:      *rootCAKey,
+		RootCAKeyPassword:     *rootCAKeyPassword,
+		RootCACert:            *rootCAPEM,
+		KeyType:               kt,
+		Curve:                 c,
+		RSABits:               *rsaBits,
+		MinRSABits:            *minRSABits,
+		KeyPassword:           *keyPassword,
+		LegacyKeyFormat:       *legacyKeyFormat,
+		Intermediate:          *intermediate,
+		IntermediateOnly:      *intermediateOnly,
+		SkipClient:            *noClient,
+		DualUsage:             *dualUsage,
+		PolicyOIDs:            policyOIDs,
+	}
+	if *clientFullchain && *noClient {
+		log.Fatal("--chain-file-for-client cannot be used with --no-client")
+	}
+	if *intermediateOnly && (*csr || *fullchain || *clientFullchain || *haproxyFile != "" || *pkcs12File != "" || *p7bFile != "") {
+		log.Fatal("--intermediate-only cannot be used with --csr, --fullchain, --chain-file-for-client, --haproxy, --pkcs12 or --p7b")
+	}
+	if *format != "pem" && *format != "der" {
+		log.Fatalf("unknown --format %q, must be pem or der", *format)
+	}
+	if *csrFormat != "pem" && *csrFormat != "der" {
+		log.Fatalf("unknown --csr-format %q, must be pem or der", *csrFormat)
+	}
+	if *csrFormat == "der" && *toStdout {
+		log.Fatal("--csr-format=der cannot be used with --stdout")
+	}
+	if !*strict && !*intermediateOnly {
+		if err := cfg.CheckLeafValidity(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v; pass --strict to make this an error\n", err)
+		}
+	}
+	out := &output{dir: *outDir, prefix: *prefix, format: *format, crlf: *crlf, force: *force, manifest: *manifest}
+	if out.certPerm, err = parsePerm("cert-perm", *certPerm); err != nil {
+		log.Fatal(err)
+	}
+	if out.keyPerm, err = parsePerm("key-perm", *keyPerm); err != nil {
+		log.Fatal(err)
+	}
+	if *crlf && (*format != "pem" || *base64Out) {
+		log.Fatal("--crlf can only be used with --format=pem")
+	}
+	var stdout io.Writer = os.Stdout
+	if *quiet {
+		stdout = ioutil.Discard
+	}
+	if *base64Out {
+		if *toStdout || *format != "pem" || *csr || *fullchain || *clientFullchain {
+			log.Fatal("--base64 cannot be used with --stdout, --format, --csr, --fullchain or --chain-file-for-client")
+		}
+		out.format = "base64"
+	}
+	if *toStdout || *base64Out {
+		if *format != "pem" {
+			log.Fatal("--stdout can only be used with --format=pem")
+		}
+		if *manifest != "" || *appendTo != "" || *haproxyFile != "" || *pkcs12File != "" || *p7bFile != "" {
+			log.Fatal("--stdout and --base64 print the certs instead of writing files, so cannot be used with --manifest, --append-to, --haproxy, --pkcs12 or --p7b")
+		}
+		// the cert data is the output, so don't describe the files
+		out.stdout, stdout = os.Stdout, ioutil.Discard
+	}
+	if *dryRun {
+		if err := cfg.Validate(); err != nil {
+			log.Fatal(err)
+		}
+		writeDryRun(os.Stdout, cfg)
+		return
+	}
+	if out.stdout == nil {
+		if err := os.MkdirAll(out.dir, 0755); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *csr {
+		req, err := gencert.GenerateCSR(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		csrName, err := out.writeCSR(req, *csrFormat == "der")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := out.commit(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(stdout, `Wrote the following files to disk - send %[2]s to your CA to get a certificate:
+
+%[1]s - the private key
+%[2]s - the certificate signing request
+`, out.path("leaf.key"), out.path(csrName))
+		return
+	}
+	certs, err := gencert.Generate(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *verifyHostname && certs.Leaf != nil {
+		if err := verifyHostnames(certs.Leaf, cfg.Hosts); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *printFingerprint {
+		if certs.Leaf != nil {
+			fmt.Fprintf(os.Stderr, "leaf SHA256:%s\n", certs.Leaf.FingerprintSHA256Hex())
+		} else {
+			fmt.Fprintf(os.Stderr, "intermediate SHA256:%s\n", certs.Intermediate.FingerprintSHA256Hex())
+		}
+		fmt.Fprintf(os.Stderr, "root SHA256:%s\n", certs.Root.FingerprintSHA256Hex())
+	}
+	if *printSerial {
+		writeSerials(os.Stderr, certs)
+	}
+	if *spkiPin {
+		if certs.Leaf != nil {
+			fmt.Fprintf(os.Stderr, "leaf pin-sha256:%s\n", certs.Leaf.SPKIPinSHA256())
+		} else {
+			fmt.Fprintf(os.Stderr, "intermediate pin-sha256:%s\n", certs.Intermediate.SPKIPinSHA256())
+		}
+		fmt.Fprintf(os.Stderr, "root pin-sha256:%s\n", certs.Root.SPKIPinSHA256())
+	}
 
-	w := bufio.NewWriter(os.Stdout)
+	if *jsonOut {
+		if err := writeJSON(os.Stdout, certs, *rootCAKey == ""); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *k8sSecretName != "" {
+		if err := writeK8sSecret(os.Stdout, *k8sSecretName, certs); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	w := bufio.NewWriter(stdout)
 	// only write root cert if we didn't just load it from disk
 	if *rootCAKey == "" {
-		if err := writeCert(certs.Root, "root"); err != nil {
+		if err := out.writeCert(certs.Root, "root"); err != nil {
 			log.Fatal(err)
 		}
+		if *appendTo != "" {
+			out.appendFile(*appendTo, "root-bundle", certs.Root, out.pemBytes(certs.Root.PublicBytes), out.certPerm)
+		}
 	}
-	if err := writeCert(certs.Leaf, "leaf"); err != nil {
+	if certs.Intermediate != nil {
+		if err := out.writeCert(certs.Intermediate, "intermediate"); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if certs.Leaf == nil {
+		fmt.Fprintf(w, `Wrote the following certs to disk - use these to sign leaf certs with --root-ca-key and --root-ca-cert:
+
+%s - the intermediate CA private key
+%s - the intermediate CA certificate
+`, out.path(out.keyName("intermediate")), out.path(out.certName("intermediate")))
+		if err := out.commit(); err != nil {
+			log.Fatal(err)
+		}
+		w.Flush()
+		return
+	}
+	if err := out.writeCert(certs.Leaf, "leaf"); err != nil {
 		log.Fatal(err)
 	}
 	fmt.Fprintf(w, `Wrote the following certs to disk - use these to terminate TLS traffic on a web server:
 
-leaf.key - the private key
-leaf.pem - the certificate
+%s - the private key
+%s - the certificate
+`, out.path(out.keyName("leaf")), out.path(out.certName("leaf")))
+	if certs.Intermediate != nil {
+		fmt.Fprintf(w, "%s - the intermediate CA certificate that signed the certificate\n", out.path(out.certName("intermediate")))
+	}
+	if *fullchain {
+		if err := out.writeFile("fullchain.pem", "fullchain", certs.Leaf, out.pemBytes(certs.FullChainPEM()), out.certPerm); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(w, "%s - the certificate followed by the CA certificate that signed it\n", out.path("fullchain.pem"))
+	}
+	if *haproxyFile != "" {
+		out.addFile(*haproxyFile, "haproxy", certs.Leaf, out.pemBytes(certs.HAProxyPEM()), out.keyPerm)
+		fmt.Fprintf(w, "%s - the private key, certificate and CA chain for HAProxy\n", *haproxyFile)
+	}
+	if *pkcs12File != "" {
+		p12, err := certs.PKCS12(*pkcs12Password)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out.addFile(*pkcs12File, "pkcs12", certs.Leaf, p12, out.keyPerm)
+		fmt.Fprintf(w, "%s - the certificate, private key and CA chain as a PKCS#12 bundle\n", *pkcs12File)
+	}
+	if *p7bFile != "" {
+		p7b, err := certs.PKCS7()
+		if err != nil {
+			log.Fatal(err)
+		}
+		out.addFile(*p7bFile, "p7b", certs.Leaf, p7b, out.certPerm)
+		fmt.Fprintf(w, "%s - the certificate and CA chain as a PKCS#7 bundle\n", *p7bFile)
+	}
+	if certs.Client != nil {
+		fmt.Fprintf(w, "\n")
+		if err := out.writeCert(certs.Client, "client"); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(w, `Wrote the following certs to disk - use these to do client TLS (less common):
 
-`)
-	if err := writeCert(certs.Client, "client"); err != nil {
+%s - the private key
+%s - the certificate
+`, out.path(out.keyName("client")), out.path(out.certName("client")))
+		if *clientFullchain {
+			if err := out.writeFile("client-fullchain.pem", "client-fullchain", certs.Client, out.pemBytes(certs.ClientFullChainPEM()), out.certPerm); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Fprintf(w, "%s - the certificate followed by the CA certificate that signed it\n", out.path("client-fullchain.pem"))
+		}
+	}
+	if err := out.commit(); err != nil {
 		log.Fatal(err)
 	}
-	fmt.Fprintf(w, `Wrote the following certs to disk - use these to do client TLS (less common):
-
-client.key - the private key
-client.pem - the certificate
-`)
 	w.Flush()
 }
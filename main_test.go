@@ -1 +1,302 @@
 package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gencert "github.com/meterup/generate-cert/lib"
+	"gopkg.in/yaml.v3"
+)
+
+func TestVerifyHostnames(t *testing.T) {
+	hosts := []string{"münchen.example.test", "*.wildcard.example.test", "[::1]", "10.0.0.1", "admin@example.test"}
+	certs, err := gencert.Generate(gencert.Config{Hosts: hosts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyHostnames(certs.Leaf, hosts); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyHostnames(certs.Leaf, []string{"other.example.test"}); err == nil {
+		t.Fatal("expected an error verifying a host the cert wasn't issued for")
+	}
+}
+
+func TestParsePerm(t *testing.T) {
+	perm, err := parsePerm("cert-perm", "0644")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm != 0644 {
+		t.Errorf("expected 0644, got %o", perm)
+	}
+	for _, s := range []string{"", "644x", "999", "01000"} {
+		if _, err := parsePerm("cert-perm", s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
+
+func TestCommitRefusesToOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	out := &output{dir: dir, format: "pem", certPerm: 0644, keyPerm: 0600}
+	if err := out.writeFile("leaf.pem", "leaf-cert", nil, []byte("first"), out.certPerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	out.writeFile("leaf.key", "leaf-key", nil, []byte("key"), out.keyPerm)
+	out.writeFile("leaf.pem", "leaf-cert", nil, []byte("second"), out.certPerm)
+	err := out.commit()
+	if err == nil || !strings.Contains(err.Error(), out.path("leaf.pem")) {
+		t.Fatalf("expected error listing leaf.pem, got %v", err)
+	}
+	if _, err := os.Stat(out.path("leaf.key")); !os.IsNotExist(err) {
+		t.Error("expected no files to be written when one already exists")
+	}
+
+	out.force = true
+	if err := out.commit(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out.path("leaf.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "second" {
+		t.Errorf("expected --force to overwrite leaf.pem, got %q", data)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	certs, err := gencert.Generate(gencert.Config{Hosts: []string{"manifest.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	out := &output{dir: dir, format: "pem", certPerm: 0644, keyPerm: 0600, manifest: filepath.Join(dir, "manifest.json")}
+	if err := out.writeCert(certs.Leaf, "leaf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.commit(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out.manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 2 {
+		t.Fatalf("expected 2 files in the manifest, got %d", len(m.Files))
+	}
+	f := m.Files[0]
+	if f.Path != out.path("leaf.pem") || f.Role != "leaf-cert" {
+		t.Errorf("unexpected manifest entry %+v", f)
+	}
+	sum := sha256.Sum256(certs.Leaf.PublicBytes)
+	if f.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("sha256: got %s, want %x", f.SHA256, sum)
+	}
+	if f.NotAfter == nil || !f.NotAfter.Equal(certs.Leaf.NotAfter) {
+		t.Errorf("not_after: got %v, want %v", f.NotAfter, certs.Leaf.NotAfter)
+	}
+}
+
+func TestWriteCertCRLF(t *testing.T) {
+	certs, err := gencert.Generate(gencert.Config{Hosts: []string{"crlf.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &output{dir: t.TempDir(), format: "pem", crlf: true, certPerm: 0644, keyPerm: 0600}
+	if err := out.writeCert(certs.Leaf, "leaf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.commit(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"leaf.pem", "leaf.key"} {
+		data, err := os.ReadFile(out.path(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Count(data, []byte("\n")) != bytes.Count(data, []byte("\r\n")) {
+			t.Errorf("%s: expected every line to end in \\r\\n", name)
+		}
+	}
+	chain := out.pemBytes(certs.FullChainPEM())
+	if n := bytes.Count(chain, []byte("\r\n")); n == 0 || n != bytes.Count(chain, []byte("\n")) {
+		t.Error("expected every line of the full chain to end in \\r\\n")
+	}
+
+	req, err := gencert.GenerateCSR(gencert.Config{Hosts: []string{"crlf.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.force = true
+	if _, err := out.writeCSR(req, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.commit(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"leaf.csr", "leaf.key"} {
+		data, err := os.ReadFile(out.path(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := bytes.Count(data, []byte("\r\n")); n == 0 || n != bytes.Count(data, []byte("\n")) {
+			t.Errorf("%s: expected every line to end in \\r\\n with --csr", name)
+		}
+	}
+
+	out.crlf = false
+	if !bytes.Equal(out.pemBytes(certs.FullChainPEM()), certs.FullChainPEM()) {
+		t.Error("expected pemBytes to leave data unchanged without crlf")
+	}
+}
+
+func TestWriteFileMode(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "leaf.key")
+	if err := os.WriteFile(name, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileMode(name, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600 over an existing 0644 file, got %v", fi.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(name); string(data) != "new" {
+		t.Errorf("got %q, want %q", data, "new")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected the temporary file to be renamed into place, got %d files", len(entries))
+	}
+
+	// the umask would normally clear the group and other write bits
+	bundle := filepath.Join(dir, "ca-bundle.pem")
+	if err := appendToFile(bundle, []byte("root\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	fi, err = os.Stat(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0666 {
+		t.Errorf("expected a new bundle to get mode 0666, got %v", fi.Mode().Perm())
+	}
+}
+
+func TestAppendFile(t *testing.T) {
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "ca-bundle.pem")
+	if err := os.WriteFile(bundle, []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := &output{dir: dir, format: "pem", certPerm: 0644, keyPerm: 0600}
+	out.appendFile(bundle, "root-bundle", nil, []byte("new\n"), out.certPerm)
+	if err := out.commit(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "existing\nnew\n" {
+		t.Errorf("got %q, want the new data appended on its own line", data)
+	}
+}
+
+func TestWriteK8sSecret(t *testing.T) {
+	certs, err := gencert.Generate(gencert.Config{Hosts: []string{"k8s.example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeK8sSecret(&buf, "example-tls", certs); err != nil {
+		t.Fatal(err)
+	}
+	var secret k8sSecret
+	if err := yaml.Unmarshal(buf.Bytes(), &secret); err != nil {
+		t.Fatal(err)
+	}
+	if secret.Kind != "Secret" || secret.Type != "kubernetes.io/tls" || secret.Metadata.Name != "example-tls" {
+		t.Errorf("unexpected secret header: %+v", secret)
+	}
+	for key, want := range map[string][]byte{
+		"tls.crt": certs.FullChainPEM(),
+		"tls.key": certs.Leaf.PrivateBytes,
+		"ca.crt":  certs.Root.PublicBytes,
+	} {
+		got, err := base64.StdEncoding.DecodeString(secret.Data[key])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestSerialHex(t *testing.T) {
+	for _, tc := range []struct {
+		serial *big.Int
+		want   string
+	}{
+		{big.NewInt(0), "00"},
+		{big.NewInt(10), "0A"},
+		{big.NewInt(0x1b2c3d), "1B:2C:3D"},
+	} {
+		if got := serialHex(tc.serial); got != tc.want {
+			t.Errorf("serialHex(%v): got %q, want %q", tc.serial, got, tc.want)
+		}
+	}
+}
+
+func TestAddHosts(t *testing.T) {
+	got := addHosts([]string{"app.example.test", " localhost"}, devHosts...)
+	want := []string{"app.example.test", " localhost", "127.0.0.1", "::1"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWriteDryRun(t *testing.T) {
+	var buf strings.Builder
+	writeDryRun(&buf, gencert.Config{
+		Hosts:      []string{"dry-run.example.test", "10.0.0.1"},
+		Orgs:       []string{"Example Co"},
+		SkipClient: true,
+	})
+	out := buf.String()
+	for _, want := range []string{"ecdsa, curve P-256", "Root CA:  generated", "dry-run.example.test, 10.0.0.1", "Organization: Example Co\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Client certificate") {
+		t.Error("expected no client certificate with SkipClient")
+	}
+}